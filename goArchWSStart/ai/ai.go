@@ -0,0 +1,167 @@
+// Package ai is the built-in computer opponent. It chooses moves with an
+// iterative-deepening alpha-beta search over business_logic positions.
+package ai
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"othello/business_logic"
+)
+
+// ErrNoMove is returned when the side to move has no legal move.
+var ErrNoMove = errors.New("no legal move")
+
+// Level is a playing strength. Stronger levels search deeper and are given
+// more time; the search stops at whichever limit it reaches first. From
+// EndgameEmpties empty squares on, the level plays perfectly using the
+// endgame solver (0 never does).
+type Level struct {
+	Name           string
+	Depth          int           // maximum search depth in plies
+	TimeBudget     time.Duration // wall-clock limit for one move
+	EndgameEmpties int
+}
+
+// Levels are the strengths offered in the lobby, weakest first.
+var Levels = []Level{
+	{Name: "beginner", Depth: 1, TimeBudget: 100 * time.Millisecond},
+	{Name: "easy", Depth: 2, TimeBudget: 250 * time.Millisecond},
+	{Name: "medium", Depth: 4, TimeBudget: time.Second},
+	{Name: "hard", Depth: 6, TimeBudget: 2 * time.Second, EndgameEmpties: 10},
+	{Name: "expert", Depth: 8, TimeBudget: 4 * time.Second, EndgameEmpties: 14},
+}
+
+// LevelByName looks up a level by its name.
+func LevelByName(name string) (Level, bool) {
+	for _, l := range Levels {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return Level{}, false
+}
+
+// PlayerName is the username the computer is seated under at a level,
+// e.g. "computer:medium".
+func PlayerName(l Level) string {
+	return business_logic.ComputerPrefix + l.Name
+}
+
+// LevelOf returns the level of a seated computer player. ok is false for
+// human players.
+func LevelOf(username string) (Level, bool) {
+	if !business_logic.IsComputerPlayer(username) {
+		return Level{}, false
+	}
+	return LevelByName(strings.TrimPrefix(username, business_logic.ComputerPrefix))
+}
+
+// searchAborted unwinds a search that ran out of time.
+var searchAborted = errors.New("search aborted")
+
+// searcher holds the state of one ChooseMove call.
+type searcher struct {
+	root     business_logic.Disc // the side the computer is playing
+	deadline time.Time
+	nodes    int
+}
+
+// ChooseMove returns the computer's move for the side to move in p.
+// Depths 1, 2, ... are searched in turn until level.Depth is reached or the
+// time budget runs out; the move from the deepest completed search is used.
+// Close enough to the end, the level's endgame solver takes over; if it
+// runs out of time the ordinary search still has the rest of the budget.
+func ChooseMove(p business_logic.Position, level Level) (int, error) {
+	moves := orderMoves(p.LegalMoves())
+	if len(moves) == 0 {
+		return 0, ErrNoMove
+	}
+	if len(moves) == 1 {
+		return moves[0], nil
+	}
+	start := time.Now()
+	if Empties(&p.Board) <= level.EndgameEmpties {
+		if sol, err := NewSolver(level.TimeBudget / 2).Solve(p); err == nil && sol.BestMove >= 0 {
+			return sol.BestMove, nil
+		}
+	}
+
+	s := &searcher{root: p.ToMove, deadline: start.Add(level.TimeBudget)}
+	best := moves[0]
+	for depth := 1; depth <= max(level.Depth, 1); depth++ {
+		move, err := s.searchRoot(p, moves, depth)
+		if err != nil {
+			break
+		}
+		best = move
+		// Search the previous best first next time: it makes the cutoffs
+		// of the deeper search far more effective.
+		i := slices.Index(moves, best)
+		copy(moves[1:i+1], moves[:i])
+		moves[0] = best
+	}
+	return best, nil
+}
+
+// searchRoot runs one fixed-depth search and returns the best move.
+func (s *searcher) searchRoot(p business_logic.Position, moves []int, depth int) (int, error) {
+	best, alpha := moves[0], math.MinInt
+	for _, sq := range moves {
+		child := p
+		if _, err := child.Play(sq); err != nil {
+			return 0, err
+		}
+		v, err := s.alphaBeta(&child, depth-1, alpha, math.MaxInt)
+		if err != nil {
+			return 0, err
+		}
+		if v > alpha {
+			best, alpha = sq, v
+		}
+	}
+	return best, nil
+}
+
+// alphaBeta is a minimax search with alpha-beta pruning. Scores are always
+// from the computer's point of view, which keeps forced passes simple: the
+// side to move just stays the same.
+func (s *searcher) alphaBeta(p *business_logic.Position, depth, alpha, beta int) (int, error) {
+	s.nodes++
+	if s.nodes%1024 == 0 && time.Now().After(s.deadline) {
+		return 0, searchAborted
+	}
+	if p.IsGameOver() {
+		return finalScore(&p.Board, s.root), nil
+	}
+	if depth == 0 {
+		return Evaluate(&p.Board, s.root), nil
+	}
+
+	maximizing := p.ToMove == s.root
+	for _, sq := range orderMoves(p.LegalMoves()) {
+		child := *p
+		if _, err := child.Play(sq); err != nil {
+			return 0, err
+		}
+		v, err := s.alphaBeta(&child, depth-1, alpha, beta)
+		if err != nil {
+			return 0, err
+		}
+		if maximizing {
+			alpha = max(alpha, v)
+		} else {
+			beta = min(beta, v)
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+	if maximizing {
+		return alpha, nil
+	}
+	return beta, nil
+}
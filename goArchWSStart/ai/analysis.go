@@ -0,0 +1,97 @@
+package ai
+
+import (
+	"fmt"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// MoveAnalysis is the solver's verdict on one endgame move. Scores are final
+// disc differentials for the player who moved, assuming perfect play from
+// there on.
+type MoveAnalysis struct {
+	Ply         int
+	Color       string
+	Square      string
+	BestSquare  string
+	BestScore   int // with the best move
+	PlayedScore int // with the move actually played
+	Loss        int // discs given away: BestScore - PlayedScore
+}
+
+// AnalyzeEndgame solves every position of a game from the point where at
+// most `empties` squares were left, and reports how much each move lost
+// against perfect play. It gives up with ErrSolveTimeout once deadline has
+// passed.
+func AnalyzeEndgame(moves []data_access.Move, empties int, deadline time.Time) ([]MoveAnalysis, error) {
+	if empties > MaxSolveEmpties {
+		return nil, ErrTooManyEmpties
+	}
+
+	// positions[k] is the position after k moves.
+	positions := []business_logic.Position{business_logic.NewPosition()}
+	for _, m := range moves {
+		p := positions[len(positions)-1]
+		color, err := business_logic.ParseDisc(m.Color)
+		if err != nil {
+			return nil, fmt.Errorf("ply %d: %w", m.Ply, err)
+		}
+		if _, err := business_logic.ApplyMove(&p, color, m.Square); err != nil {
+			return nil, fmt.Errorf("ply %d (%s %s): %w", m.Ply, m.Color, m.Square, err)
+		}
+		positions = append(positions, p)
+	}
+
+	first := len(moves)
+	for k := range moves {
+		if Empties(&positions[k].Board) <= empties {
+			first = k
+			break
+		}
+	}
+	if first == len(moves) {
+		return nil, nil
+	}
+
+	// Solve from the end backwards: the later, smaller searches fill the
+	// transposition table for the earlier ones.
+	solver := NewSolverUntil(deadline)
+	solutions := make([]Solution, len(positions))
+	for k := len(positions) - 1; k >= first; k-- {
+		sol, err := solver.Solve(positions[k])
+		if err != nil {
+			return nil, fmt.Errorf("position after ply %d: %w", k, err)
+		}
+		solutions[k] = sol
+	}
+
+	// valueFor is position k's perfect-play result for color.
+	valueFor := func(k int, color business_logic.Disc) int {
+		p := &positions[k]
+		if p.IsGameOver() {
+			return discDiff(&p.Board, color)
+		}
+		if p.ToMove == color {
+			return solutions[k].Score
+		}
+		return -solutions[k].Score
+	}
+
+	out := make([]MoveAnalysis, 0, len(moves)-first)
+	for k := first; k < len(moves); k++ {
+		mover := positions[k].ToMove
+		a := MoveAnalysis{
+			Ply:         moves[k].Ply,
+			Color:       moves[k].Color,
+			Square:      moves[k].Square,
+			BestSquare:  business_logic.SquareName(solutions[k].BestMove),
+			BestScore:   solutions[k].Score,
+			PlayedScore: valueFor(k+1, mover),
+		}
+		a.Loss = a.BestScore - a.PlayedScore
+		out = append(out, a)
+	}
+	return out, nil
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"math/bits"
+	"slices"
+
+	"othello/business_logic"
+)
+
+// squareWeights is the positional value of holding each square. Corners can
+// never be flipped; the X- and C-squares next to an empty corner tend to give
+// it away.
+var squareWeights = [64]int{
+	100, -20, 10, 5, 5, 10, -20, 100,
+	-20, -50, -2, -2, -2, -2, -50, -20,
+	10, -2, 1, 1, 1, 1, -2, 10,
+	5, -2, 1, 0, 0, 1, -2, 5,
+	5, -2, 1, 0, 0, 1, -2, 5,
+	10, -2, 1, 1, 1, 1, -2, 10,
+	-20, -50, -2, -2, -2, -2, -50, -20,
+	100, -20, 10, 5, 5, 10, -20, 100,
+}
+
+// Evaluation weights.
+const (
+	mobilityWeight = 5    // per legal move more than the opponent
+	winScore       = 1e6  // any won game beats any unfinished position
+	discWeight     = 1000 // per disc of final margin, so bigger wins rank higher
+)
+
+// corners and the X-squares diagonally inside them, in matching order.
+var (
+	corners  = [4]int{0, 7, 56, 63}
+	xSquares = [4]int{9, 14, 49, 54}
+)
+
+// Evaluate scores an unfinished position for color: positional weights of
+// the discs held, plus mobility. An X-square stops counting against its
+// owner once the corner next to it is taken.
+func Evaluate(b *business_logic.Board, color business_logic.Disc) int {
+	opp := color.Opponent()
+	score := 0
+	for sq, w := range squareWeights {
+		switch b.At(sq) {
+		case color:
+			score += w
+		case opp:
+			score -= w
+		}
+	}
+	for i, corner := range corners {
+		if b.At(corner) == business_logic.Empty {
+			continue
+		}
+		switch b.At(xSquares[i]) {
+		case color:
+			score -= squareWeights[xSquares[i]]
+		case opp:
+			score += squareWeights[xSquares[i]]
+		}
+	}
+
+	mine, theirs := bits.OnesCount64(b.LegalMask(color)), bits.OnesCount64(b.LegalMask(opp))
+	score += mobilityWeight * (mine - theirs)
+	return score
+}
+
+// finalScore scores a finished game for color by its result and margin.
+func finalScore(b *business_logic.Board, color business_logic.Disc) int {
+	black, white := b.Score()
+	margin := black - white
+	if color == business_logic.White {
+		margin = -margin
+	}
+	switch {
+	case margin > 0:
+		return winScore + margin*discWeight
+	case margin < 0:
+		return -winScore + margin*discWeight
+	}
+	return 0
+}
+
+// orderMoves sorts moves best-looking first by square weight, so alpha-beta
+// sees corners early and X-squares last.
+func orderMoves(moves []int) []int {
+	slices.SortStableFunc(moves, func(a, b int) int { return squareWeights[b] - squareWeights[a] })
+	return moves
+}
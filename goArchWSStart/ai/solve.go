@@ -0,0 +1,211 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"time"
+
+	"othello/business_logic"
+)
+
+// MaxSolveEmpties is the most empty squares the endgame solver accepts.
+// Beyond that an exact search takes far too long.
+const MaxSolveEmpties = 20
+
+// Errors returned by the solver.
+var (
+	ErrTooManyEmpties = fmt.Errorf("more than %d empty squares", MaxSolveEmpties)
+	ErrSolveTimeout   = errors.New("endgame solve ran out of time")
+)
+
+// Solution is the exact result of a position under perfect play by both
+// sides.
+type Solution struct {
+	Score    int // final disc differential for the side to move (empties go to the winner)
+	BestMove int // -1 when the game is already over
+}
+
+// ttBound says how a transposition-table score relates to the true value.
+type ttBound uint8
+
+const (
+	boundExact ttBound = iota
+	boundLower         // true value >= score (the search failed high)
+	boundUpper         // true value <= score (the search failed low)
+)
+
+type ttKey struct {
+	board  business_logic.Board
+	toMove business_logic.Disc
+}
+
+type ttEntry struct {
+	score int
+	bound ttBound
+	best  int
+}
+
+// maxTTEntries caps the transposition table; once full, new positions are
+// no longer stored.
+const maxTTEntries = 1 << 20
+
+// Solver solves endgames exactly. Its transposition table is kept between
+// calls, which pays off when solving consecutive positions of one game.
+// A Solver is not safe for concurrent use.
+type Solver struct {
+	tt       map[ttKey]ttEntry
+	budget   time.Duration
+	until    time.Time // shared deadline of every Solve call; zero if none
+	deadline time.Time // zero for no limit
+	nodes    int
+}
+
+// NewSolver returns a solver that gives up with ErrSolveTimeout after the
+// given budget per Solve call (0 for no limit).
+func NewSolver(budget time.Duration) *Solver {
+	return &Solver{tt: make(map[ttKey]ttEntry), budget: budget}
+}
+
+// NewSolverUntil returns a solver whose Solve calls all give up with
+// ErrSolveTimeout once deadline has passed, however many there are.
+func NewSolverUntil(deadline time.Time) *Solver {
+	return &Solver{tt: make(map[ttKey]ttEntry), until: deadline}
+}
+
+// Empties returns the number of empty squares on a board.
+func Empties(b *business_logic.Board) int {
+	black, white := b.Count()
+	return business_logic.BoardSize*business_logic.BoardSize - black - white
+}
+
+// Solve returns the exact final disc differential of p for the side to move
+// and a move that achieves it.
+func (s *Solver) Solve(p business_logic.Position) (Solution, error) {
+	if p.IsGameOver() {
+		return Solution{Score: 0, BestMove: -1}, nil
+	}
+	if Empties(&p.Board) > MaxSolveEmpties {
+		return Solution{}, ErrTooManyEmpties
+	}
+
+	s.deadline = s.until
+	if s.budget > 0 {
+		s.deadline = time.Now().Add(s.budget)
+	}
+	score, best, err := s.negamax(&p, p.ToMove, -solveInf, solveInf)
+	if err != nil {
+		return Solution{}, err
+	}
+	return Solution{Score: score, BestMove: best}, nil
+}
+
+// solveInf is beyond any possible disc differential.
+const solveInf = business_logic.BoardSize*business_logic.BoardSize + 1
+
+// discDiff is the final differential for color on a finished board.
+func discDiff(b *business_logic.Board, color business_logic.Disc) int {
+	black, white := b.Score()
+	if color == business_logic.White {
+		return white - black
+	}
+	return black - white
+}
+
+// negamax returns the value of p for color (the side to move) and the move
+// that achieves it. The value is exact when it falls inside (alpha, beta),
+// otherwise it is a bound. Forced passes keep the same side to move, so only
+// a real change of turn negates the child's value.
+func (s *Solver) negamax(p *business_logic.Position, color business_logic.Disc, alpha, beta int) (int, int, error) {
+	s.nodes++
+	if s.nodes%4096 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		return 0, -1, ErrSolveTimeout
+	}
+
+	origAlpha := alpha
+	key := ttKey{p.Board, color}
+	entry, hit := s.tt[key]
+	if hit {
+		switch entry.bound {
+		case boundExact:
+			return entry.score, entry.best, nil
+		case boundLower:
+			alpha = max(alpha, entry.score)
+		case boundUpper:
+			beta = min(beta, entry.score)
+		}
+		if alpha >= beta {
+			return entry.score, entry.best, nil
+		}
+	}
+
+	moves := s.orderSolveMoves(p, entry, hit)
+	best, bestMove := -solveInf, -1
+	for _, sq := range moves {
+		child := *p
+		if _, err := child.Play(sq); err != nil {
+			return 0, -1, err
+		}
+
+		var v int
+		var err error
+		switch {
+		case child.IsGameOver():
+			v = discDiff(&child.Board, color)
+		case child.ToMove == color:
+			v, _, err = s.negamax(&child, color, alpha, beta)
+		default:
+			v, _, err = s.negamax(&child, color.Opponent(), -beta, -alpha)
+			v = -v
+		}
+		if err != nil {
+			return 0, -1, err
+		}
+
+		if v > best {
+			best, bestMove = v, sq
+		}
+		alpha = max(alpha, v)
+		if alpha >= beta {
+			break
+		}
+	}
+
+	if len(s.tt) < maxTTEntries {
+		e := ttEntry{score: best, bound: boundExact, best: bestMove}
+		switch {
+		case best <= origAlpha:
+			e.bound = boundUpper
+		case best >= beta:
+			e.bound = boundLower
+		}
+		s.tt[key] = e
+	}
+	return best, bestMove, nil
+}
+
+// orderSolveMoves puts the table's best move first, then, far from the end,
+// the moves that leave the opponent the fewest replies ("fastest first"),
+// which finds cutoffs quickly. Near the end square weights are cheaper and
+// good enough.
+func (s *Solver) orderSolveMoves(p *business_logic.Position, entry ttEntry, hit bool) []int {
+	moves := orderMoves(p.LegalMoves())
+	if Empties(&p.Board) > 6 {
+		replies := make(map[int]int, len(moves))
+		opp := p.ToMove.Opponent()
+		for _, sq := range moves {
+			child := p.Board
+			child.Play(p.ToMove, sq)
+			replies[sq] = bits.OnesCount64(child.LegalMask(opp))
+		}
+		slices.SortStableFunc(moves, func(a, b int) int { return replies[a] - replies[b] })
+	}
+	if hit && entry.best >= 0 {
+		if i := slices.Index(moves, entry.best); i > 0 {
+			copy(moves[1:i+1], moves[:i])
+			moves[0] = entry.best
+		}
+	}
+	return moves
+}
@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"math/rand"
+	"testing"
+
+	"othello/business_logic"
+)
+
+// solveCases are endgame positions with their exact result for the side to
+// move under perfect play, and the only move that achieves it.
+var solveCases = []struct {
+	board  string
+	toMove business_logic.Disc
+	score  int
+	best   string
+}{
+	{"OXXXX-XOOOXXXXXOOOXXXXXO-XOOXXXOXXXXXXXOXXOO-OOOXXXXO-OOXXXXXXXO", business_logic.Black, 0, "a4"},   // 4 empties
+	{"XXXOOX-OOOOOOOOO-OOOOOOOXOOXOOOOOOXOOXXOOOOOXXX-OOOOXXXX-OOO-XO-", business_logic.Black, 2, "g1"},   // 6 empties
+	{"O-OOOOOOOOOOOO-OOOXOOOXOOXOOXOOOOOXOXOOOOOOOOOOXX-XXXOO--O-X--OX", business_logic.Black, -10, "g2"}, // 8 empties
+	{"X-XOOO--XXXXXO--XXXXOO-XXXXOXXOXX-OOXXXOXOOXXXXXOOOO-OOXOOOOOX--", business_logic.Black, -10, "h8"}, // 10 empties
+}
+
+func TestSolve(t *testing.T) {
+	for _, tc := range solveCases {
+		b, err := business_logic.ParseBoard(tc.board)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sol, err := NewSolver(0).Solve(business_logic.Position{Board: b, ToMove: tc.toMove})
+		if err != nil {
+			t.Fatalf("Solve(%s): %v", tc.board, err)
+		}
+		if sol.Score != tc.score || business_logic.SquareName(sol.BestMove) != tc.best {
+			t.Errorf("Solve(%s) = %d with %s, want %d with %s", tc.board, sol.Score,
+				business_logic.SquareName(sol.BestMove), tc.score, tc.best)
+		}
+	}
+}
+
+// minimax is a plain search with no transposition table or pruning: slow,
+// but too simple to get wrong.
+func minimax(p business_logic.Position) int {
+	best := -solveInf
+	for _, sq := range p.LegalMoves() {
+		child := p
+		child.Play(sq)
+		var v int
+		switch {
+		case child.IsGameOver():
+			v = discDiff(&child.Board, p.ToMove)
+		case child.ToMove == p.ToMove:
+			v = minimax(child)
+		default:
+			v = -minimax(child)
+		}
+		best = max(best, v)
+	}
+	return best
+}
+
+// TestSolveTranspositionTable solves the last plies of random games with one
+// solver, so later solves start from a table the earlier ones filled, and
+// checks every result against minimax.
+func TestSolveTranspositionTable(t *testing.T) {
+	const empties = 9
+	rng := rand.New(rand.NewSource(1))
+	for game := 0; game < 5; game++ {
+		p := business_logic.NewPosition()
+		for !p.IsGameOver() && Empties(&p.Board) > empties {
+			moves := p.LegalMoves()
+			p.Play(moves[rng.Intn(len(moves))])
+		}
+		solver := NewSolver(0)
+		for ; !p.IsGameOver(); p.Play(p.LegalMoves()[0]) {
+			sol, err := solver.Solve(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := minimax(p); sol.Score != want {
+				t.Errorf("game %d, %s to move on %s: Solve = %d, minimax = %d", game, p.ToMove, p.Board, sol.Score, want)
+			}
+		}
+	}
+}
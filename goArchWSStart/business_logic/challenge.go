@@ -0,0 +1,140 @@
+package business_logic
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"othello/data_access"
+)
+
+// ChallengeTTL is how long a challenge stays open before it expires.
+const ChallengeTTL = 2 * time.Minute
+
+// maxOutgoingChallenges caps how many challenges one user may have open at once.
+const maxOutgoingChallenges = 5
+
+var (
+	ErrChallengeExpired   = errors.New("challenge has expired")
+	ErrChallengeForbidden = errors.New("not allowed to act on this challenge")
+)
+
+// CreateChallenge opens a challenge from one user to another. An empty `to`
+// posts an open seek. color is the challenger's preferred color and may be
+// "black", "white" or "random" (the default).
+func CreateChallenge(from, to, color, timeControl string, rated bool) (data_access.Challenge, error) {
+	if err := ValidateUsername(from); err != nil {
+		return data_access.Challenge{}, err
+	}
+	if from == to {
+		return data_access.Challenge{}, fmt.Errorf("you cannot challenge yourself")
+	}
+	switch color {
+	case "":
+		color = "random"
+	case "black", "white", "random":
+	default:
+		return data_access.Challenge{}, fmt.Errorf("color must be black, white or random")
+	}
+	tc, err := ParseTimeControl(timeControl)
+	if err != nil {
+		return data_access.Challenge{}, err
+	}
+
+	outgoing := 0
+	for _, c := range data_access.ListChallenges(from) {
+		if c.From != from {
+			continue
+		}
+		if c.To == to {
+			return data_access.Challenge{}, fmt.Errorf("you already have a pending challenge to %s", describeOpponent(to))
+		}
+		outgoing++
+	}
+	if outgoing >= maxOutgoingChallenges {
+		return data_access.Challenge{}, fmt.Errorf("too many open challenges (max %d)", maxOutgoingChallenges)
+	}
+
+	now := time.Now()
+	c := data_access.Challenge{
+		ID:          GenRandomHex(8),
+		From:        from,
+		To:          to,
+		Color:       color,
+		TimeControl: tc.String(),
+		Rated:       rated,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ChallengeTTL),
+	}
+	data_access.SaveChallenge(c)
+	return c, nil
+}
+
+func describeOpponent(to string) string {
+	if to == "" {
+		return "the lobby"
+	}
+	return to
+}
+
+// AcceptChallenge accepts a challenge on behalf of username and starts the
+// game. Only the challenged user (or, for an open seek, anyone but the
+// challenger) may accept.
+func AcceptChallenge(id, username string) (data_access.Challenge, data_access.Game, error) {
+	c, err := data_access.TakeChallenge(id, func(c data_access.Challenge) error {
+		if time.Now().After(c.ExpiresAt) {
+			return ErrChallengeExpired
+		}
+		if c.From == username || (c.To != "" && c.To != username) {
+			return ErrChallengeForbidden
+		}
+		return nil
+	})
+	if err != nil {
+		return c, data_access.Game{}, err
+	}
+
+	black, white := c.From, username
+	switch c.Color {
+	case "white":
+		black, white = white, black
+	case "random":
+		if rand.IntN(2) == 1 {
+			black, white = white, black
+		}
+	}
+	g, err := NewGame(black, white, c.TimeControl, c.Rated)
+	return c, g, err
+}
+
+// DeclineChallenge removes a challenge addressed to username.
+func DeclineChallenge(id, username string) (data_access.Challenge, error) {
+	return data_access.TakeChallenge(id, func(c data_access.Challenge) error {
+		if c.To != username {
+			return ErrChallengeForbidden
+		}
+		return nil
+	})
+}
+
+// CancelChallenge removes a challenge sent by username.
+func CancelChallenge(id, username string) (data_access.Challenge, error) {
+	return data_access.TakeChallenge(id, func(c data_access.Challenge) error {
+		if c.From != username {
+			return ErrChallengeForbidden
+		}
+		return nil
+	})
+}
+
+// ExpireChallenge removes a challenge once its expiry time has passed. It
+// returns ErrChallengeNotFound if the challenge was already resolved.
+func ExpireChallenge(id string) (data_access.Challenge, error) {
+	return data_access.TakeChallenge(id, func(c data_access.Challenge) error {
+		if time.Now().Before(c.ExpiresAt) {
+			return fmt.Errorf("challenge %s has not expired yet", id)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package business_logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"othello/data_access"
+)
+
+// ErrNotMessageAuthor is returned when someone tries to change a chat
+// message they did not write.
+var ErrNotMessageAuthor = errors.New("you can only change your own messages")
+
+// PostChatMessage stores a chat message in a room. The caller has already
+// checked that the user may post there. Muted and banned users may not (see
+// CanPostChat), and the text is cleaned first; see CleanChatMessage.
+func PostChatMessage(room, accountToken, username, text string) (data_access.ChatMessage, error) {
+	if err := CanPostChat(username); err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	text, err := CleanChatMessage(text)
+	if err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	return data_access.InsertMessage(context.Background(), room, accountToken, username, text)
+}
+
+// authoredMessage returns a message of a room if username wrote it. A
+// message in another room is reported as not found.
+func authoredMessage(room string, id int64, username string) (data_access.ChatMessage, error) {
+	m, err := data_access.GetMessage(context.Background(), id)
+	if err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	if m.Room_ID != room {
+		return data_access.ChatMessage{}, data_access.ErrChatMessageNotFound
+	}
+	if username == "" || m.Username != username {
+		return data_access.ChatMessage{}, ErrNotMessageAuthor
+	}
+	return m, nil
+}
+
+// EditChatMessage replaces the text of a user's own message in a room. The
+// message keeps its ID and date and is marked edited. Like posting, editing
+// is closed to muted and banned users.
+func EditChatMessage(room string, id int64, username, text string) (data_access.ChatMessage, error) {
+	if err := CanPostChat(username); err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return data_access.ChatMessage{}, fmt.Errorf("message cannot be empty; delete it instead")
+	}
+	text, err := CleanChatMessage(text)
+	if err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	if _, err := authoredMessage(room, id, username); err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	return data_access.UpdateMessage(context.Background(), id, text)
+}
+
+// DeleteChatMessage removes a user's own message from a room.
+func DeleteChatMessage(room string, id int64, username string) error {
+	if _, err := authoredMessage(room, id, username); err != nil {
+		return err
+	}
+	return data_access.DeleteMessage(context.Background(), id)
+}
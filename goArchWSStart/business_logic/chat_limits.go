@@ -0,0 +1,133 @@
+package business_logic
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ChatLimits configures chat flood protection. Every chat action (posting,
+// editing or deleting a message) takes a token from the sender's bucket and
+// from its connection's bucket; with either empty the action is throttled.
+// Each throttled action is a strike, and Strikes strikes within StrikeWindow
+// mute the user: for MuteBase the first time, twice as long each time after,
+// up to MuteMax. A user who goes MuteForget without a mute starts over.
+type ChatLimits struct {
+	UserRate     float64 // tokens per second refilled into a user's bucket
+	UserBurst    int     // size of a user's bucket
+	ConnRate     float64 // tokens per second refilled into a connection's bucket
+	ConnBurst    int     // size of a connection's bucket
+	Strikes      int
+	StrikeWindow time.Duration
+	MuteBase     time.Duration
+	MuteMax      time.Duration
+	MuteForget   time.Duration
+}
+
+// DefaultChatLimits allow a user a burst of 8 messages and one a second
+// after that, spread over any number of connections.
+var DefaultChatLimits = ChatLimits{
+	UserRate:     1,
+	UserBurst:    8,
+	ConnRate:     1,
+	ConnBurst:    5,
+	Strikes:      5,
+	StrikeWindow: 30 * time.Second,
+	MuteBase:     30 * time.Second,
+	MuteMax:      time.Hour,
+	MuteForget:   24 * time.Hour,
+}
+
+// ChatLimitsFromEnv returns DefaultChatLimits with any of these settings
+// overridden from the environment (getenv is usually os.Getenv):
+//
+//	CHAT_USER_RATE, CHAT_CONN_RATE      messages per second, e.g. 0.5
+//	CHAT_USER_BURST, CHAT_CONN_BURST    messages
+//	CHAT_STRIKES                        throttled messages before a mute
+//	CHAT_STRIKE_WINDOW, CHAT_MUTE_BASE,
+//	CHAT_MUTE_MAX, CHAT_MUTE_FORGET     durations, e.g. 30s or 1h
+func ChatLimitsFromEnv(getenv func(string) string) (ChatLimits, error) {
+	l := DefaultChatLimits
+	rates := map[string]*float64{"CHAT_USER_RATE": &l.UserRate, "CHAT_CONN_RATE": &l.ConnRate}
+	for name, p := range rates {
+		if v := getenv(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f <= 0 {
+				return ChatLimits{}, fmt.Errorf("%s must be a positive number, not %q", name, v)
+			}
+			*p = f
+		}
+	}
+	counts := map[string]*int{"CHAT_USER_BURST": &l.UserBurst, "CHAT_CONN_BURST": &l.ConnBurst, "CHAT_STRIKES": &l.Strikes}
+	for name, p := range counts {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return ChatLimits{}, fmt.Errorf("%s must be a positive whole number, not %q", name, v)
+			}
+			*p = n
+		}
+	}
+	durations := map[string]*time.Duration{
+		"CHAT_STRIKE_WINDOW": &l.StrikeWindow,
+		"CHAT_MUTE_BASE":     &l.MuteBase,
+		"CHAT_MUTE_MAX":      &l.MuteMax,
+		"CHAT_MUTE_FORGET":   &l.MuteForget,
+	}
+	for name, p := range durations {
+		if v := getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return ChatLimits{}, fmt.Errorf("%s must be a positive duration, not %q", name, v)
+			}
+			*p = d
+		}
+	}
+	if l.MuteMax < l.MuteBase {
+		return ChatLimits{}, fmt.Errorf("CHAT_MUTE_MAX (%v) is shorter than CHAT_MUTE_BASE (%v)", l.MuteMax, l.MuteBase)
+	}
+	return l, nil
+}
+
+// MuteDuration returns how long a user's mute lasts when it is their level'th
+// in a row (starting at 0).
+func (l ChatLimits) MuteDuration(level int) time.Duration {
+	d := l.MuteBase
+	for i := 0; i < level && d < l.MuteMax; i++ {
+		d *= 2
+	}
+	return min(d, l.MuteMax)
+}
+
+// TokenBucket is a token-bucket rate limiter. The zero value is a full
+// bucket. It is not safe for concurrent use.
+type TokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Wait refills the bucket at rate tokens per second up to burst and returns
+// how long until a token is available, 0 if one is now. It takes nothing, so
+// a caller can check several buckets before taking from any of them.
+func (b *TokenBucket) Wait(now time.Time, rate float64, burst int) time.Duration {
+	if b.updated.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = min(float64(burst), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	}
+	b.updated = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return max(time.Duration((1-b.tokens)/rate*float64(time.Second)), 1)
+}
+
+// Take refills the bucket like Wait and takes one token. If the bucket is
+// empty it returns false and how long until a token is available.
+func (b *TokenBucket) Take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	if wait := b.Wait(now, rate, burst); wait > 0 {
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
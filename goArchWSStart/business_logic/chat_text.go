@@ -0,0 +1,156 @@
+package business_logic
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxChatMessageLength is the longest chat message, in characters, after
+// normalization.
+const MaxChatMessageLength = 500
+
+// CleanChatMessage checks the text of a chat message and returns it in its
+// stored form: NFC-normalized, trimmed, with \n line breaks. It rejects
+// empty and overlong messages and ones containing other control characters,
+// including the bidirectional overrides that can make text display
+// differently from how it reads. Finally the chat word filter is applied (see
+// SetChatWordFilter), which may mask words or reject the message.
+func CleanChatMessage(text string) (string, error) {
+	return cleanChatText(text, MaxChatMessageLength)
+}
+
+// cleanChatText is CleanChatMessage with a limit of maxLen characters, for
+// direct messages, which may be longer.
+func cleanChatText(text string, maxLen int) (string, error) {
+	if !utf8.ValidString(text) {
+		return "", fmt.Errorf("message is not valid UTF-8")
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSpace(norm.NFC.String(text))
+	if text == "" {
+		return "", fmt.Errorf("message cannot be empty")
+	}
+	if utf8.RuneCountInString(text) > maxLen {
+		return "", fmt.Errorf("message is longer than %d characters", maxLen)
+	}
+	for _, r := range text {
+		if (unicode.IsControl(r) && r != '\n') || isBidiControl(r) {
+			return "", fmt.Errorf("message contains control characters")
+		}
+	}
+	return filterChatText(text)
+}
+
+// isBidiControl reports whether r is a bidirectional embedding, override or
+// isolate character.
+func isBidiControl(r rune) bool {
+	return (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069')
+}
+
+// Kinds of ChatToken.
+const (
+	TokenText = "text"
+	TokenBold = "bold"
+	TokenCode = "code"
+	TokenLink = "link"
+)
+
+// ChatToken is one piece of a chat message's markup. Text is always plain
+// text; Href is set for links and is always an http or https URL.
+type ChatToken struct {
+	Kind string
+	Text string
+	Href string
+}
+
+// ParseChatMarkup splits a chat message into tokens. The markup is a small,
+// flat subset of Markdown:
+//
+//	**bold**  `code`  [label](https://example.com)  https://example.com
+//
+// Anything else, including unclosed markers and links to other schemes, is
+// plain text. Clients render the tokens as text nodes, so a message cannot
+// carry HTML of its own.
+func ParseChatMarkup(text string) []ChatToken {
+	var tokens []ChatToken
+	addText := func(s string) {
+		if s == "" {
+			return
+		}
+		if n := len(tokens); n > 0 && tokens[n-1].Kind == TokenText {
+			tokens[n-1].Text += s
+			return
+		}
+		tokens = append(tokens, ChatToken{Kind: TokenText, Text: s})
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		prev := lastRune(text[:i])
+		if tok, n := markupAt(rest, i == 0 || unicode.IsSpace(prev) || prev == '('); n > 0 {
+			tokens = append(tokens, tok)
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		addText(rest[:size])
+		i += size
+	}
+	return tokens
+}
+
+// markupAt parses the markup token at the start of s, if there is one, and
+// returns it with its length in bytes. Bare URLs only start a token at the
+// start of a word (or after an opening parenthesis).
+func markupAt(s string, wordStart bool) (ChatToken, int) {
+	switch {
+	case strings.HasPrefix(s, "`"):
+		if end := strings.Index(s[1:], "`"); end > 0 {
+			return ChatToken{Kind: TokenCode, Text: s[1 : 1+end]}, end + 2
+		}
+	case strings.HasPrefix(s, "**"):
+		if end := strings.Index(s[2:], "**"); end > 0 {
+			return ChatToken{Kind: TokenBold, Text: s[2 : 2+end]}, end + 4
+		}
+	case strings.HasPrefix(s, "["):
+		label, after, ok := strings.Cut(s[1:], "](")
+		if !ok || label == "" || strings.ContainsAny(label, "[]") {
+			break
+		}
+		href, _, ok := strings.Cut(after, ")")
+		if ok && safeLink(href) {
+			return ChatToken{Kind: TokenLink, Text: label, Href: href}, len(label) + len(href) + 4
+		}
+	case wordStart && (strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")):
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		// Punctuation ending a sentence is not part of the link.
+		href := strings.TrimRight(s[:end], ".,;:!?)'\"")
+		if safeLink(href) {
+			return ChatToken{Kind: TokenLink, Text: href, Href: href}, len(href)
+		}
+	}
+	return ChatToken{}, 0
+}
+
+// safeLink reports whether href is an absolute http or https URL.
+func safeLink(href string) bool {
+	if strings.ContainsFunc(href, unicode.IsSpace) {
+		return false
+	}
+	u, err := url.Parse(href)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// lastRune returns the last rune of s, or utf8.RuneError if s is empty.
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
@@ -0,0 +1,180 @@
+package business_logic
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"othello/data_access"
+)
+
+// ErrFlagFell is returned for a move that arrives after the mover's time ran out.
+// The game has been ended on time by the time it is returned.
+var ErrFlagFell = errors.New("time has run out")
+
+// ClockState is a timed game's clocks at one instant.
+type ClockState struct {
+	Black   time.Duration
+	White   time.Duration
+	Running string // color whose clock is running, "" if none
+}
+
+// Clocks run from black's first move: the side to move is charged for the
+// time since its turn started, less the delay in simple-delay games. Black's
+// first move is free, so an abandoned game can be aborted instead of lost on
+// time.
+
+// gameTimeControl parses a game's stored time control; bad values count as
+// untimed, matching TimeControlCategory.
+func gameTimeControl(g data_access.Game) TimeControl {
+	tc, err := ParseTimeControl(g.TimeControl)
+	if err != nil {
+		return TimeControl{}
+	}
+	return tc
+}
+
+// clockRunning reports whether the side to move's clock is ticking.
+func clockRunning(g data_access.Game) bool {
+	return g.Status == data_access.GameActive && g.ToMove != "" && !g.ClockStarted.IsZero()
+}
+
+// chargeable returns how much of the current turn is deducted from the
+// mover's clock at now.
+func chargeable(g data_access.Game, tc TimeControl, now time.Time) time.Duration {
+	return max(now.Sub(g.ClockStarted)-tc.Delay, 0)
+}
+
+// GameClock returns the clocks of a game as of now. ok is false for
+// untimed games.
+func GameClock(g data_access.Game, now time.Time) (state ClockState, ok bool) {
+	tc := gameTimeControl(g)
+	if tc.IsUntimed() {
+		return ClockState{}, false
+	}
+	state = ClockState{Black: g.BlackClock, White: g.WhiteClock}
+	if clockRunning(g) {
+		state.Running = g.ToMove
+		spent := chargeable(g, tc, now)
+		if g.ToMove == "black" {
+			state.Black = max(state.Black-spent, 0)
+		} else {
+			state.White = max(state.White-spent, 0)
+		}
+	}
+	return state, true
+}
+
+// TimeUntilFlag returns how long the side to move has left. ok is false
+// when no clock is running.
+func TimeUntilFlag(g data_access.Game, now time.Time) (time.Duration, bool) {
+	state, ok := GameClock(g, now)
+	if !ok || state.Running == "" {
+		return 0, false
+	}
+	if state.Running == "black" {
+		return state.Black, true
+	}
+	return state.White, true
+}
+
+// clockFor returns a pointer to the given color's stored clock.
+func clockFor(g *data_access.Game, color string) *time.Duration {
+	if color == "black" {
+		return &g.BlackClock
+	}
+	return &g.WhiteClock
+}
+
+// flagIfExpired ends the game on time if the side to move has no time left
+// at now. It reports whether it did.
+func flagIfExpired(g *data_access.Game, now time.Time) bool {
+	left, ok := TimeUntilFlag(*g, now)
+	if !ok || left > 0 {
+		return false
+	}
+	loser := g.ToMove
+	*clockFor(g, loser) = 0
+	c, _ := ParseDisc(loser)
+	finishGame(g, c.Opponent().String(), ReasonTimeout, now)
+	return true
+}
+
+// punchClock charges the mover for the turn that ends at now, adds the
+// Fischer increment, and starts the opponent's turn. It returns the mover's
+// remaining time.
+func punchClock(g *data_access.Game, color string, now time.Time) time.Duration {
+	tc := gameTimeControl(*g)
+	if tc.IsUntimed() {
+		return 0
+	}
+	clock := clockFor(g, color)
+	if clockRunning(*g) {
+		*clock = max(*clock-chargeable(*g, tc, now), 0)
+	}
+	*clock += tc.Increment
+	g.ClockStarted = now
+	return *clock
+}
+
+// finishGame marks a game finished with the given result ("black", "white"
+// or "draw") and reason, stops its clocks and withdraws any draw offer.
+func finishGame(g *data_access.Game, result, reason string, now time.Time) {
+	g.Status = data_access.GameFinished
+	g.Result = result
+	g.ResultReason = reason
+	g.ToMove = ""
+	g.FinishedAt = now
+	g.ClockStarted = time.Time{}
+	g.DrawOffer = ""
+}
+
+// restoreClocks rebuilds a loaded game's clocks from the remaining time
+// stored with each move. An active game is only loaded after a restart, and
+// the time the server was down is not charged to anyone: the side to move's
+// turn restarts at now with the time they had left.
+func restoreClocks(g *data_access.Game, now time.Time) {
+	tc := gameTimeControl(*g)
+	if tc.IsUntimed() {
+		return
+	}
+	g.BlackClock, g.WhiteClock = tc.Base, tc.Base
+	for _, m := range g.Moves {
+		*clockFor(g, m.Color) = m.Clock
+	}
+	if n := len(g.Moves); n > 0 && g.Status == data_access.GameActive {
+		g.ClockStarted = now
+	}
+}
+
+// recordResult persists a finished game and rates it. Failures are logged:
+// the live store stays authoritative.
+func recordResult(g data_access.Game) {
+	if err := data_access.SaveGame(context.Background(), g); err != nil {
+		log.Printf("failed to store result of game %d: %v", g.ID, err)
+	}
+	if err := RateGame(g); err != nil {
+		log.Printf("failed to rate game %d: %v", g.ID, err)
+	}
+}
+
+// FlagGame ends a game on time if the side to move's clock has run out.
+// It is called when a flag timer fires, so a game is lost on time even if
+// neither player sends anything. flagged reports whether the game ended.
+func FlagGame(gameID int64) (g data_access.Game, flagged bool, err error) {
+	if _, err := LoadGame(gameID); err != nil {
+		return data_access.Game{}, false, err
+	}
+	g, err = data_access.UpdateGame(gameID, func(g *data_access.Game) error {
+		flagged = flagIfExpired(g, time.Now())
+		return nil
+	})
+	if err != nil {
+		return g, false, err
+	}
+	if flagged {
+		recordResult(g)
+	}
+	return g, flagged, nil
+}
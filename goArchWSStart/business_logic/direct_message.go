@@ -0,0 +1,49 @@
+package business_logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"othello/data_access"
+)
+
+// MaxDirectMessageLen is the longest direct message accepted, in characters.
+const MaxDirectMessageLen = 2000
+
+// ErrNoSuchUser is returned when a message is addressed to an unknown account.
+var ErrNoSuchUser = errors.New("no such user")
+
+// SendDirectMessage stores a private message from one user to another. The
+// recipient must be a registered account other than the sender, and the
+// sender must not be muted or banned (see CanPostChat). The body is checked
+// and normalized like chat text (see CleanChatMessage), up to
+// MaxDirectMessageLen characters. If allow is not nil it is called once the
+// message has passed those checks, just before it is stored, and its error is
+// returned as is; callers use it to charge rate limits only for messages that
+// would otherwise be sent.
+func SendDirectMessage(from, to, body string, allow func() error) (data_access.DirectMessage, error) {
+	if from == to {
+		return data_access.DirectMessage{}, fmt.Errorf("you cannot message yourself")
+	}
+	if err := CanPostChat(from); err != nil {
+		return data_access.DirectMessage{}, err
+	}
+	body, err := cleanChatText(body, MaxDirectMessageLen)
+	if err != nil {
+		return data_access.DirectMessage{}, err
+	}
+	if _, ok := data_access.GetUser(to); !ok {
+		return data_access.DirectMessage{}, fmt.Errorf("%w: %s", ErrNoSuchUser, to)
+	}
+	if allow != nil {
+		if err := allow(); err != nil {
+			return data_access.DirectMessage{}, err
+		}
+	}
+	return data_access.InsertDirectMessage(context.Background(), data_access.DirectMessage{
+		From: from,
+		To:   to,
+		Body: body,
+	})
+}
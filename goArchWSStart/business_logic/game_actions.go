@@ -0,0 +1,199 @@
+package business_logic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"othello/data_access"
+)
+
+// Result reasons stored with a finished game.
+const (
+	ReasonScore       = "score"       // played out; decided by counting discs
+	ReasonResignation = "resignation" // the loser resigned
+	ReasonTimeout     = "timeout"     // the loser's clock ran out
+	ReasonAgreement   = "agreement"   // draw agreed by both players
+	ReasonAbort       = "abort"       // called off before it got going
+)
+
+// AbortPlyLimit is how many moves may have been played and the game still
+// be aborted: once each side has made its first move the game counts.
+const AbortPlyLimit = 2
+
+// Errors returned by the game actions below.
+var (
+	ErrActionNotAllowed = errors.New("action not allowed")
+	ErrNoOffer          = errors.New("no offer to answer")
+)
+
+// Othello games can end level at 32-32, so draw offers are part of the
+// protocol; there is no separate draw-less variant to exclude.
+
+// gameEnded reports whether a game will accept no more moves.
+func gameEnded(g data_access.Game) bool {
+	return g.Status == data_access.GameFinished || g.Status == data_access.GameAborted
+}
+
+// gameAction loads a game and runs fn on it under the store lock with the
+// caller's seat color already checked. If fn reports that it ended the game,
+// the result is persisted (and rated) afterwards.
+func gameAction(gameID int64, username string, fn func(g *data_access.Game, color string) (ended bool, err error)) (data_access.Game, error) {
+	if _, err := LoadGame(gameID); err != nil {
+		return data_access.Game{}, err
+	}
+	var ended bool
+	g, err := data_access.UpdateGame(gameID, func(g *data_access.Game) error {
+		color := g.ColorOf(username)
+		if color == "" {
+			return fmt.Errorf("%w: %s in game %d", ErrNotSeated, username, gameID)
+		}
+		var err error
+		ended, err = fn(g, color)
+		return err
+	})
+	if err != nil {
+		return g, err
+	}
+	if ended {
+		recordResult(g)
+	}
+	return g, nil
+}
+
+// requireActive rejects actions on games that are not being played.
+func requireActive(g *data_access.Game) error {
+	switch g.Status {
+	case data_access.GameWaiting:
+		return ErrGameNotStarted
+	case data_access.GameFinished, data_access.GameAborted:
+		return ErrGameOver
+	}
+	return nil
+}
+
+// ResignGame ends an active game as a loss for username.
+func ResignGame(gameID int64, username string) (data_access.Game, error) {
+	return gameAction(gameID, username, func(g *data_access.Game, color string) (bool, error) {
+		if err := requireActive(g); err != nil {
+			return false, err
+		}
+		c, _ := ParseDisc(color)
+		finishGame(g, c.Opponent().String(), ReasonResignation, time.Now())
+		return true, nil
+	})
+}
+
+// AbortGame calls off a game with no result. It is allowed while the game
+// is waiting for an opponent, and while fewer than AbortPlyLimit moves have
+// been played. Aborted games are not rated.
+func AbortGame(gameID int64, username string) (data_access.Game, error) {
+	return gameAction(gameID, username, func(g *data_access.Game, color string) (bool, error) {
+		if gameEnded(*g) {
+			return false, ErrGameOver
+		}
+		if len(g.Moves) >= AbortPlyLimit {
+			return false, fmt.Errorf("%w: games can only be aborted before %d moves are played", ErrActionNotAllowed, AbortPlyLimit)
+		}
+		g.Status = data_access.GameAborted
+		g.ResultReason = ReasonAbort
+		g.ToMove = ""
+		g.FinishedAt = time.Now()
+		g.ClockStarted = time.Time{}
+		g.DrawOffer = ""
+		return true, nil
+	})
+}
+
+// OfferDraw records username's draw offer. If the opponent already offered
+// one, the offer is taken as acceptance and the game is drawn; agreed
+// reports that. An offer stands until the opponent answers or a move is
+// played.
+func OfferDraw(gameID int64, username string) (g data_access.Game, agreed bool, err error) {
+	g, err = gameAction(gameID, username, func(g *data_access.Game, color string) (bool, error) {
+		if err := requireActive(g); err != nil {
+			return false, err
+		}
+		switch g.DrawOffer {
+		case color:
+			return false, fmt.Errorf("%w: draw already offered", ErrActionNotAllowed)
+		case "":
+			g.DrawOffer = color
+			return false, nil
+		}
+		finishGame(g, "draw", ReasonAgreement, time.Now())
+		agreed = true
+		return true, nil
+	})
+	return g, agreed, err
+}
+
+// AnswerDraw accepts or declines the opponent's pending draw offer.
+func AnswerDraw(gameID int64, username string, accept bool) (data_access.Game, error) {
+	return gameAction(gameID, username, func(g *data_access.Game, color string) (bool, error) {
+		if err := requireActive(g); err != nil {
+			return false, err
+		}
+		if g.DrawOffer == "" || g.DrawOffer == color {
+			return false, fmt.Errorf("%w: no draw offer from your opponent", ErrNoOffer)
+		}
+		if !accept {
+			g.DrawOffer = ""
+			return false, nil
+		}
+		finishGame(g, "draw", ReasonAgreement, time.Now())
+		return true, nil
+	})
+}
+
+// OfferRematch records username's wish for a rematch of a finished game.
+// If the opponent already asked, a new game is created with the colors
+// swapped and the same time control and rating setting; rematch is that
+// game, or nil while the offer is pending.
+func OfferRematch(gameID int64, username string) (data_access.Game, *data_access.Game, error) {
+	var accepted bool
+	g, err := gameAction(gameID, username, func(g *data_access.Game, color string) (bool, error) {
+		if !gameEnded(*g) {
+			return false, fmt.Errorf("%w: the game is still in progress", ErrActionNotAllowed)
+		}
+		if g.Black == "" || g.White == "" {
+			return false, fmt.Errorf("%w: the game never had two players", ErrActionNotAllowed)
+		}
+		switch {
+		case g.RematchID != 0:
+			return false, fmt.Errorf("%w: rematch already started as game %d", ErrActionNotAllowed, g.RematchID)
+		case g.RematchOffer == color:
+			return false, fmt.Errorf("%w: rematch already offered", ErrActionNotAllowed)
+		case g.RematchOffer == "":
+			g.RematchOffer = color
+			return false, nil
+		}
+		accepted = true
+		g.RematchOffer = ""
+		return false, nil
+	})
+	if err != nil || !accepted {
+		return g, nil, err
+	}
+
+	rematch, err := NewGame(g.White, g.Black, g.TimeControl, g.Rated)
+	if err != nil {
+		return g, nil, err
+	}
+	g, err = data_access.UpdateGame(gameID, func(g *data_access.Game) error {
+		g.RematchID = rematch.ID
+		return nil
+	})
+	return g, &rematch, err
+}
+
+// DeclineRematch turns down the opponent's rematch offer.
+func DeclineRematch(gameID int64, username string) (data_access.Game, error) {
+	return gameAction(gameID, username, func(g *data_access.Game, color string) (bool, error) {
+		if g.RematchOffer == "" || g.RematchOffer == color || g.RematchID != 0 {
+			return false, fmt.Errorf("%w: no rematch offer from your opponent", ErrNoOffer)
+		}
+		g.RematchOffer = ""
+		return false, nil
+	})
+}
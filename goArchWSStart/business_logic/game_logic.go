@@ -1,16 +1,233 @@
 package business_logic
 
-// ValidateTurnTransition validates if a turn transition is allowed
-// This is where you add core business rules like:
-// - whether the user is in the game
-// - whether it's actually their turn
-// - game state checks, etc.
-func ValidateTurnTransition() error {
-	// Add business logic validation here
-	// For now, we'll allow any transition
-	// In reality, you'd check game state, player status, etc.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"othello/data_access"
+)
+
+// Errors returned by the game-level functions below.
+var (
+	ErrNotSeated      = errors.New("not seated in this game")
+	ErrGameNotStarted = errors.New("game is waiting for an opponent")
+	ErrBadPly         = errors.New("no such ply")
+)
+
+// ValidateTurnTransition checks that color may play sq in position p:
+// the game must still be running, it must be color's turn, and the move
+// must flip at least one disc.
+func ValidateTurnTransition(p *Position, color Disc, sq int) error {
+	if p.IsGameOver() {
+		return ErrGameOver
+	}
+	if color != p.ToMove {
+		return fmt.Errorf("%w: it is %s's turn", ErrIllegalMove, p.ToMove)
+	}
+	if sq < 0 || sq >= BoardSize*BoardSize {
+		return ErrBadSquare
+	}
+	if !p.Board.IsLegal(color, sq) {
+		return fmt.Errorf("%w: %s cannot play %s", ErrIllegalMove, color, SquareName(sq))
+	}
 	return nil
 }
 
-// Note: GetCurrentTurn and AdvanceTurn are now handled through the service layer
-// which orchestrates the business logic validation with data access calls.
+// ApplyMove validates and plays a move given in algebraic notation (e.g. "f5").
+// The position is only modified when the move is legal.
+func ApplyMove(p *Position, color Disc, square string) (MoveResult, error) {
+	sq, err := ParseSquare(square)
+	if err != nil {
+		return MoveResult{}, err
+	}
+	if err := ValidateTurnTransition(p, color, sq); err != nil {
+		return MoveResult{}, err
+	}
+	return p.Play(sq)
+}
+
+// NewGame creates a game in the starting position. Either seat may be left
+// empty ("") so another player can join later. timeControl uses the
+// ParseTimeControl notation; "" creates an untimed game. Rated games update
+// both players' ratings when they finish.
+func NewGame(black, white, timeControl string, rated bool) (data_access.Game, error) {
+	tc, err := ParseTimeControl(timeControl)
+	if err != nil {
+		return data_access.Game{}, err
+	}
+	return data_access.CreateGame(data_access.Game{
+		Black:       black,
+		White:       white,
+		Board:       NewBoard().String(),
+		TimeControl: tc.String(),
+		Rated:       rated,
+		BlackClock:  tc.Base,
+		WhiteClock:  tc.Base,
+	})
+}
+
+// GamePosition decodes the board and side to move stored for a game.
+func GamePosition(g data_access.Game) (Position, error) {
+	board, err := ParseBoard(g.Board)
+	if err != nil {
+		return Position{}, err
+	}
+	p := Position{Board: board}
+	if !gameEnded(g) && g.ToMove != "" {
+		if p.ToMove, err = ParseDisc(g.ToMove); err != nil {
+			return Position{}, err
+		}
+	}
+	return p, nil
+}
+
+// ReplayMoves rebuilds a position from a move list, validating every move
+// under the full Othello rules. Passes are implicit: each stored move must
+// be by the side the rules say is to move.
+func ReplayMoves(moves []data_access.Move) (Position, error) {
+	p := NewPosition()
+	for _, m := range moves {
+		color, err := ParseDisc(m.Color)
+		if err != nil {
+			return p, fmt.Errorf("ply %d: %w", m.Ply, err)
+		}
+		if _, err := ApplyMove(&p, color, m.Square); err != nil {
+			return p, fmt.Errorf("ply %d (%s %s): %w", m.Ply, m.Color, m.Square, err)
+		}
+	}
+	return p, nil
+}
+
+// PositionAt replays the first ply moves of a game (0 for the starting
+// position) and returns the position reached, along with the result of the
+// last move played to get there (zero at ply 0).
+func PositionAt(moves []data_access.Move, ply int) (Position, MoveResult, error) {
+	if ply < 0 || ply > len(moves) {
+		return Position{}, MoveResult{}, fmt.Errorf("%w: %d (the game has %d)", ErrBadPly, ply, len(moves))
+	}
+	p, err := ReplayMoves(moves[:max(ply-1, 0)])
+	if err != nil || ply == 0 {
+		return p, MoveResult{}, err
+	}
+	last := moves[ply-1]
+	color, err := ParseDisc(last.Color)
+	if err != nil {
+		return p, MoveResult{}, fmt.Errorf("ply %d: %w", ply, err)
+	}
+	res, err := ApplyMove(&p, color, last.Square)
+	if err != nil {
+		return p, MoveResult{}, fmt.Errorf("ply %d (%s %s): %w", ply, last.Color, last.Square, err)
+	}
+	return p, res, nil
+}
+
+// LoadGame returns the live game with the given ID. If the game is not in
+// memory (e.g. after a restart) it is read from the database, its board is
+// rebuilt by replaying the stored moves and its clocks restored (see
+// restoreClocks).
+func LoadGame(gameID int64) (data_access.Game, error) {
+	if g, err := data_access.GetGame(gameID); err == nil {
+		return g, nil
+	}
+
+	g, err := data_access.LoadGame(context.Background(), gameID)
+	if err != nil {
+		return data_access.Game{}, err
+	}
+	p, err := ReplayMoves(g.Moves)
+	if err != nil {
+		return data_access.Game{}, fmt.Errorf("game %d has an invalid move record: %w", gameID, err)
+	}
+	g.Board = p.Board.String()
+	g.ToMove = ""
+	if !p.IsGameOver() && !gameEnded(g) {
+		g.ToMove = p.ToMove.String()
+	}
+	restoreClocks(&g, time.Now())
+	return data_access.CacheGame(g), nil
+}
+
+// PlayGameMove validates and applies a move by username in the given game.
+// The whole read-validate-write runs under the game store's lock, so two
+// moves arriving at once for the same game cannot both be accepted.
+// A move that arrives after the mover's flag fell ends the game on time and
+// returns ErrFlagFell along with the finished game.
+func PlayGameMove(gameID int64, username, square string) (data_access.Game, MoveResult, error) {
+	if _, err := LoadGame(gameID); err != nil {
+		return data_access.Game{}, MoveResult{}, err
+	}
+
+	var res MoveResult
+	var move data_access.Move
+	flagged := false
+	g, err := data_access.UpdateGame(gameID, func(g *data_access.Game) error {
+		now := time.Now()
+		if flagIfExpired(g, now) {
+			flagged = true
+			return nil
+		}
+
+		switch g.Status {
+		case data_access.GameWaiting:
+			return ErrGameNotStarted
+		case data_access.GameFinished, data_access.GameAborted:
+			return ErrGameOver
+		}
+
+		color := g.ColorOf(username)
+		if color == "" {
+			return fmt.Errorf("%w: %s in game %d", ErrNotSeated, username, gameID)
+		}
+		c, _ := ParseDisc(color)
+
+		p, err := GamePosition(*g)
+		if err != nil {
+			return err
+		}
+		if res, err = ApplyMove(&p, c, square); err != nil {
+			return err
+		}
+
+		move = data_access.Move{
+			Ply:      len(g.Moves) + 1,
+			Color:    color,
+			Square:   SquareName(res.Square),
+			PlayedAt: now,
+			Clock:    punchClock(g, color, now),
+		}
+		g.Moves = append(g.Moves, move)
+		g.DrawOffer = ""
+		g.Board = p.Board.String()
+		g.ToMove = ""
+		if !p.IsGameOver() {
+			g.ToMove = p.ToMove.String()
+		} else {
+			result := p.Board.Winner().String()
+			if result == Empty.String() {
+				result = "draw"
+			}
+			finishGame(g, result, ReasonScore, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return g, res, err
+	}
+	if flagged {
+		recordResult(g)
+		return g, MoveResult{GameOver: true}, ErrFlagFell
+	}
+
+	// Persist after the in-memory update; the live store stays authoritative
+	// if the DB write fails.
+	if err := data_access.InsertMove(context.Background(), gameID, move); err != nil {
+		log.Printf("PlayGameMove: failed to store move %d of game %d: %v", move.Ply, gameID, err)
+	}
+	if res.GameOver {
+		recordResult(g)
+	}
+	return g, res, nil
+}
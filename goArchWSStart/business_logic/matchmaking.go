@@ -0,0 +1,70 @@
+package business_logic
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// QueueEntry is one player waiting in the "play now" queue.
+type QueueEntry struct {
+	Username    string
+	TimeControl string // normalized, see TimeControl.String
+	Rating      float64
+	JoinedAt    time.Time
+}
+
+// Rating-gap window: a player is first offered opponents within
+// initialRatingGap points, and the window grows by ratingGapStep every
+// ratingGapInterval they keep waiting, up to maxRatingGap.
+const (
+	initialRatingGap  = 100.0
+	ratingGapStep     = 50.0
+	ratingGapInterval = 10 * time.Second
+	maxRatingGap      = 800.0
+)
+
+// AllowedRatingGap returns how far apart two ratings may be for a player who
+// has waited for the given duration.
+func AllowedRatingGap(waited time.Duration) float64 {
+	if waited < 0 {
+		waited = 0
+	}
+	gap := initialRatingGap + ratingGapStep*float64(waited/ratingGapInterval)
+	return math.Min(gap, maxRatingGap)
+}
+
+// PairQueue chooses which queued players to match. Only players with the
+// same time control are paired. Players are considered in the order they
+// joined, and each is paired with the closest-rated opponent whose rating is
+// within the window allowed by the longer of the two waits. Unmatched players
+// stay in the queue for the next round.
+func PairQueue(entries []QueueEntry, now time.Time) [][2]QueueEntry {
+	sorted := slices.Clone(entries)
+	slices.SortFunc(sorted, func(a, b QueueEntry) int { return a.JoinedAt.Compare(b.JoinedAt) })
+
+	paired := make([]bool, len(sorted))
+	var pairs [][2]QueueEntry
+	for i, a := range sorted {
+		if paired[i] {
+			continue
+		}
+		best, bestGap := -1, math.Inf(1)
+		for j := i + 1; j < len(sorted); j++ {
+			b := sorted[j]
+			if paired[j] || b.TimeControl != a.TimeControl || b.Username == a.Username {
+				continue
+			}
+			gap := math.Abs(a.Rating - b.Rating)
+			// a joined first, so a has waited at least as long as b
+			if gap <= AllowedRatingGap(now.Sub(a.JoinedAt)) && gap < bestGap {
+				best, bestGap = j, gap
+			}
+		}
+		if best >= 0 {
+			paired[i], paired[best] = true, true
+			pairs = append(pairs, [2]QueueEntry{a, sorted[best]})
+		}
+	}
+	return pairs
+}
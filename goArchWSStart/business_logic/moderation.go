@@ -0,0 +1,272 @@
+package business_logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"othello/data_access"
+)
+
+// Moderation errors.
+var (
+	ErrNotModerator = errors.New("only moderators can do that")
+	ErrChatMuted    = errors.New("you are muted")
+	ErrChatBanned   = errors.New("you are banned from chat")
+)
+
+// MaxMuteDuration is the longest mute a moderator can give; longer than
+// that is a ban.
+const MaxMuteDuration = 30 * 24 * time.Hour
+
+// maxModerationReason is the longest reason, in characters, a moderator or
+// reporter can give.
+const maxModerationReason = 500
+
+// IsModerator reports whether a user may moderate chat.
+func IsModerator(username string) bool {
+	if username == "" {
+		return false
+	}
+	mod, err := data_access.IsModerator(context.Background(), username)
+	return err == nil && mod
+}
+
+// CanPostChat returns an error explaining why a user may not post or edit
+// chat messages, or send direct messages, right now (ErrChatBanned or
+// ErrChatMuted, with the reason and, for a mute, when it ends), or nil if
+// they may.
+func CanPostChat(username string) error {
+	sanctions, err := data_access.ActiveSanctions(context.Background(), username, time.Now())
+	if err != nil {
+		return err
+	}
+	// A ban outranks any mute; of several mutes the longest counts.
+	var mute *data_access.ChatSanction
+	for i, s := range sanctions {
+		if s.Kind == data_access.SanctionBan {
+			return sanctionError(ErrChatBanned, s)
+		}
+		if mute == nil || s.ExpiresAt.After(mute.ExpiresAt) {
+			mute = &sanctions[i]
+		}
+	}
+	if mute != nil {
+		return sanctionError(ErrChatMuted, *mute)
+	}
+	return nil
+}
+
+// sanctionError wraps ErrChatMuted or ErrChatBanned with the details of the
+// sanction.
+func sanctionError(base error, s data_access.ChatSanction) error {
+	var details string
+	if !s.ExpiresAt.IsZero() {
+		details += " until " + s.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC")
+	}
+	if s.Reason != "" {
+		details += ": " + s.Reason
+	}
+	return fmt.Errorf("%w%s", base, details)
+}
+
+// moderationReason trims a reason and checks its length.
+func moderationReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxModerationReason {
+		return "", fmt.Errorf("reason is longer than %d characters", maxModerationReason)
+	}
+	return reason, nil
+}
+
+// withReason appends a moderator's reason, if any, to an audit detail.
+func withReason(detail, reason string) string {
+	if reason == "" {
+		return detail
+	}
+	return detail + "; " + reason
+}
+
+// moderationTarget checks that moderator may act on target: moderator is a
+// moderator, and target is another user who is not one.
+func moderationTarget(moderator, target string) error {
+	if !IsModerator(moderator) {
+		return ErrNotModerator
+	}
+	if target == moderator {
+		return fmt.Errorf("you cannot moderate yourself")
+	}
+	if _, ok := data_access.GetUser(target); !ok {
+		return fmt.Errorf("%w: %s", ErrNoSuchUser, target)
+	}
+	if IsModerator(target) {
+		return fmt.Errorf("moderators cannot be muted or banned")
+	}
+	return nil
+}
+
+// audit records a moderation action in the audit log. The action has
+// already happened, so a failure to record it is logged rather than
+// returned.
+func audit(e data_access.ModerationEntry) {
+	if _, err := data_access.InsertModerationEntry(context.Background(), e); err != nil {
+		log.Printf("moderation: could not record %s of %s by %s: %v", e.Action, e.Target, e.Actor, err)
+	}
+}
+
+// MuteUser keeps target from posting in chat for the given duration.
+func MuteUser(moderator, target string, d time.Duration, reason string) (data_access.ChatSanction, error) {
+	if err := moderationTarget(moderator, target); err != nil {
+		return data_access.ChatSanction{}, err
+	}
+	if d <= 0 || d > MaxMuteDuration {
+		return data_access.ChatSanction{}, fmt.Errorf("mute duration must be between 1s and %v", MaxMuteDuration)
+	}
+	return sanction(moderator, target, data_access.SanctionMute, time.Now().Add(d).Truncate(time.Second), reason)
+}
+
+// BanUser keeps target from posting in chat until the ban is lifted.
+func BanUser(moderator, target, reason string) (data_access.ChatSanction, error) {
+	if err := moderationTarget(moderator, target); err != nil {
+		return data_access.ChatSanction{}, err
+	}
+	return sanction(moderator, target, data_access.SanctionBan, time.Time{}, reason)
+}
+
+// sanction stores and logs a mute or ban.
+func sanction(moderator, target, kind string, expires time.Time, reason string) (data_access.ChatSanction, error) {
+	reason, err := moderationReason(reason)
+	if err != nil {
+		return data_access.ChatSanction{}, err
+	}
+	s, err := data_access.InsertSanction(context.Background(), data_access.ChatSanction{
+		Username:  target,
+		Kind:      kind,
+		Reason:    reason,
+		CreatedBy: moderator,
+		ExpiresAt: expires,
+	})
+	if err != nil {
+		return data_access.ChatSanction{}, err
+	}
+	detail := reason
+	if !expires.IsZero() {
+		detail = withReason("until "+expires.UTC().Format(time.RFC3339), reason)
+	}
+	audit(data_access.ModerationEntry{Actor: moderator, Action: kind, Target: target, Detail: detail})
+	return s, nil
+}
+
+// LiftSanction ends target's active mutes or bans (kind is
+// data_access.SanctionMute or SanctionBan).
+func LiftSanction(moderator, target, kind string) error {
+	if !IsModerator(moderator) {
+		return ErrNotModerator
+	}
+	n, err := data_access.LiftSanctions(context.Background(), target, kind, time.Now())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s has no active %s", target, kind)
+	}
+	audit(data_access.ModerationEntry{Actor: moderator, Action: "un" + kind, Target: target})
+	return nil
+}
+
+// ModeratorDeleteMessage removes any chat message and returns it.
+func ModeratorDeleteMessage(moderator string, id int64, reason string) (data_access.ChatMessage, error) {
+	if !IsModerator(moderator) {
+		return data_access.ChatMessage{}, ErrNotModerator
+	}
+	reason, err := moderationReason(reason)
+	if err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	m, err := data_access.GetMessage(context.Background(), id)
+	if err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	if err := data_access.DeleteMessage(context.Background(), id); err != nil {
+		return data_access.ChatMessage{}, err
+	}
+	audit(data_access.ModerationEntry{
+		Actor:     moderator,
+		Action:    "delete",
+		Target:    m.Username,
+		MessageID: id,
+		Detail:    withReason(fmt.Sprintf("in %s: %q", m.Room_ID, m.Message), reason),
+	})
+	return m, nil
+}
+
+// ClearUserHistory removes every chat message target wrote and returns them.
+func ClearUserHistory(moderator, target, reason string) ([]data_access.ChatMessage, error) {
+	if !IsModerator(moderator) {
+		return nil, ErrNotModerator
+	}
+	reason, err := moderationReason(reason)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := data_access.DeleteUserMessages(context.Background(), target)
+	if err != nil {
+		return nil, err
+	}
+	audit(data_access.ModerationEntry{
+		Actor:  moderator,
+		Action: "clear",
+		Target: target,
+		Detail: withReason(fmt.Sprintf("%d messages", len(removed)), reason),
+	})
+	return removed, nil
+}
+
+// ReportMessage reports a message of a room to the moderators. The caller
+// has already checked that the reporter can read the room.
+func ReportMessage(reporter, room string, id int64, reason string) (data_access.ChatReport, error) {
+	reason, err := moderationReason(reason)
+	if err != nil {
+		return data_access.ChatReport{}, err
+	}
+	m, err := data_access.GetMessage(context.Background(), id)
+	if err != nil {
+		return data_access.ChatReport{}, err
+	}
+	if m.Room_ID != room {
+		return data_access.ChatReport{}, data_access.ErrChatMessageNotFound
+	}
+	if m.Username == reporter {
+		return data_access.ChatReport{}, fmt.Errorf("you cannot report your own message")
+	}
+	r, err := data_access.InsertReport(context.Background(), data_access.ChatReport{
+		MessageID:    id,
+		Room:         room,
+		Reporter:     reporter,
+		ReportedUser: m.Username,
+		Message:      m.Message,
+		Reason:       reason,
+	})
+	if err != nil {
+		return data_access.ChatReport{}, err
+	}
+	audit(data_access.ModerationEntry{Actor: reporter, Action: "report", Target: m.Username, MessageID: id, Detail: reason})
+	return r, nil
+}
+
+// ResolveReport closes a report once a moderator has dealt with it.
+func ResolveReport(moderator string, id int64) (data_access.ChatReport, error) {
+	if !IsModerator(moderator) {
+		return data_access.ChatReport{}, ErrNotModerator
+	}
+	r, err := data_access.ResolveReport(context.Background(), id, moderator)
+	if err != nil {
+		return data_access.ChatReport{}, err
+	}
+	audit(data_access.ModerationEntry{Actor: moderator, Action: "resolve", Target: r.ReportedUser, MessageID: r.MessageID})
+	return r, nil
+}
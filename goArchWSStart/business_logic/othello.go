@@ -0,0 +1,400 @@
+package business_logic
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Disc is the content of a single board square.
+type Disc int8
+
+const (
+	Empty Disc = iota
+	Black
+	White
+)
+
+// Errors returned by the rules engine. Callers can compare against these
+// to decide which HTTP status or WebSocket error to send back.
+var (
+	ErrIllegalMove = errors.New("illegal move")
+	ErrGameOver    = errors.New("game is over")
+	ErrBadSquare   = errors.New("invalid square")
+)
+
+// BoardSize is the number of rows (and columns) on an Othello board.
+const BoardSize = 8
+
+// Opponent returns the other color. Empty has no opponent and returns Empty.
+func (d Disc) Opponent() Disc {
+	switch d {
+	case Black:
+		return White
+	case White:
+		return Black
+	}
+	return Empty
+}
+
+func (d Disc) String() string {
+	switch d {
+	case Black:
+		return "black"
+	case White:
+		return "white"
+	}
+	return "empty"
+}
+
+// ParseDisc converts "black"/"white" (as sent by clients) into a Disc.
+func ParseDisc(s string) (Disc, error) {
+	switch strings.ToLower(s) {
+	case "black", "b", "x":
+		return Black, nil
+	case "white", "w", "o":
+		return White, nil
+	}
+	return Empty, fmt.Errorf("unknown color %q", s)
+}
+
+// Squares are numbered 0..63 row by row, starting at a1 in the top-left
+// corner, so square = row*8 + col. SquareName and ParseSquare convert to and
+// from the usual Othello notation where the column is a letter a-h and the
+// row is a digit 1-8 (e.g. "f5").
+
+// SquareName returns the algebraic name of a square, e.g. 37 -> "f5".
+func SquareName(sq int) string {
+	if sq < 0 || sq >= BoardSize*BoardSize {
+		return "??"
+	}
+	return fmt.Sprintf("%c%d", 'a'+sq%BoardSize, sq/BoardSize+1)
+}
+
+// ParseSquare converts an algebraic square name (case-insensitive) into a square index.
+func ParseSquare(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return -1, fmt.Errorf("%w: %q", ErrBadSquare, s)
+	}
+	return int(s[1]-'1')*BoardSize + int(s[0]-'a'), nil
+}
+
+// Board is an 8x8 Othello board stored as two bitboards, one per color.
+// Bit n of each is square n, so a1 is bit 0 and h8 is bit 63. Boards are
+// small values: copying one is cheap and they can be compared with ==.
+type Board struct {
+	black, white uint64
+}
+
+// Column masks used to stop shifts wrapping from one row into the next.
+const (
+	notFileA uint64 = 0xfefefefefefefefe // every square except column a
+	notFileH uint64 = 0x7f7f7f7f7f7f7f7f // every square except column h
+)
+
+// shifts holds, for each of the eight directions a line of discs can be
+// flipped in, the bit distance of one step (positive shifts left) and the
+// mask that drops squares which wrapped around a board edge.
+var shifts = [8]struct {
+	n    int
+	mask uint64
+}{
+	{1, notFileA},           // east
+	{-1, notFileH},          // west
+	{BoardSize, ^uint64(0)}, // south (towards row 8)
+	{-BoardSize, ^uint64(0)},
+	{BoardSize + 1, notFileA},
+	{BoardSize - 1, notFileH},
+	{-(BoardSize - 1), notFileA},
+	{-(BoardSize + 1), notFileH},
+}
+
+// shift moves every bit of x one step in direction d.
+func shift(x uint64, d int) uint64 {
+	s := shifts[d]
+	if s.n > 0 {
+		return (x << s.n) & s.mask
+	}
+	return (x >> -s.n) & s.mask
+}
+
+// NewBoard returns the standard starting position: white on d4 and e5,
+// black on e4 and d5.
+func NewBoard() Board {
+	return Board{
+		black: 1<<28 | 1<<35, // e4, d5
+		white: 1<<27 | 1<<36, // d4, e5
+	}
+}
+
+// Bitboard returns the squares held by color c as a bit set; for Empty it
+// returns the empty squares.
+func (b *Board) Bitboard(c Disc) uint64 {
+	switch c {
+	case Black:
+		return b.black
+	case White:
+		return b.white
+	}
+	return ^(b.black | b.white)
+}
+
+// At returns the disc on a square.
+func (b *Board) At(sq int) Disc {
+	if sq < 0 || sq >= BoardSize*BoardSize {
+		return Empty
+	}
+	bit := uint64(1) << sq
+	switch {
+	case b.black&bit != 0:
+		return Black
+	case b.white&bit != 0:
+		return White
+	}
+	return Empty
+}
+
+// LegalMask returns every square color c may play on as a bit set. Each
+// direction is handled at once for all of c's discs: runs of opponent discs
+// are grown outward from them, and an empty square just past a run is a move.
+func (b *Board) LegalMask(c Disc) uint64 {
+	if c != Black && c != White {
+		return 0
+	}
+	own, opp := b.Bitboard(c), b.Bitboard(c.Opponent())
+	empty := ^(own | opp)
+	var moves uint64
+	for d := range shifts {
+		run := shift(own, d) & opp
+		for i := 0; i < BoardSize-3; i++ { // a run is at most six discs long
+			run |= shift(run, d) & opp
+		}
+		moves |= shift(run, d) & empty
+	}
+	return moves
+}
+
+// flipMask returns the discs that flip if color c plays on sq. Zero means
+// the move is not legal.
+func (b *Board) flipMask(c Disc, sq int) uint64 {
+	if sq < 0 || sq >= BoardSize*BoardSize || c == Empty {
+		return 0
+	}
+	move := uint64(1) << sq
+	own, opp := b.Bitboard(c), b.Bitboard(c.Opponent())
+	if (own|opp)&move != 0 {
+		return 0
+	}
+	var flips uint64
+	for d := range shifts {
+		var line uint64
+		x := shift(move, d)
+		for x&opp != 0 {
+			line |= x
+			x = shift(x, d)
+		}
+		// The run of opponent discs only counts if it is capped by one of ours.
+		if x&own != 0 {
+			flips |= line
+		}
+	}
+	return flips
+}
+
+// IsLegal reports whether color c may play on sq.
+func (b *Board) IsLegal(c Disc, sq int) bool {
+	return b.flipMask(c, sq) != 0
+}
+
+// LegalMoves returns every square color c may play on, in ascending order.
+func (b *Board) LegalMoves(c Disc) []int {
+	return squaresOf(b.LegalMask(c))
+}
+
+// HasLegalMove reports whether color c has at least one legal move.
+func (b *Board) HasLegalMove(c Disc) bool {
+	return b.LegalMask(c) != 0
+}
+
+// squaresOf lists the squares in a bit set, in ascending order.
+func squaresOf(set uint64) []int {
+	out := make([]int, 0, bits.OnesCount64(set))
+	for set != 0 {
+		out = append(out, bits.TrailingZeros64(set))
+		set &= set - 1
+	}
+	return out
+}
+
+// apply plays a move known to be legal, given its flip mask.
+func (b *Board) apply(c Disc, sq int, flips uint64) {
+	move := uint64(1) << sq
+	if c == Black {
+		b.black |= move | flips
+		b.white &^= flips
+	} else {
+		b.white |= move | flips
+		b.black &^= flips
+	}
+}
+
+// Play places a disc of color c on sq and flips the captured discs.
+// It returns the flipped squares, or ErrIllegalMove if the move captures nothing.
+func (b *Board) Play(c Disc, sq int) ([]int, error) {
+	if c != Black && c != White {
+		return nil, fmt.Errorf("%w: no color to move", ErrIllegalMove)
+	}
+	flips := b.flipMask(c, sq)
+	if flips == 0 {
+		return nil, fmt.Errorf("%w: %s cannot play %s", ErrIllegalMove, c, SquareName(sq))
+	}
+	b.apply(c, sq, flips)
+	return squaresOf(flips), nil
+}
+
+// Count returns the number of black and white discs on the board.
+func (b *Board) Count() (black, white int) {
+	return bits.OnesCount64(b.black), bits.OnesCount64(b.white)
+}
+
+// IsGameOver reports whether neither side has a legal move.
+func (b *Board) IsGameOver() bool {
+	return !b.HasLegalMove(Black) && !b.HasLegalMove(White)
+}
+
+// Score returns the final score of a finished game. Following the usual
+// tournament rule, empty squares are awarded to the winner.
+func (b *Board) Score() (black, white int) {
+	black, white = b.Count()
+	empty := BoardSize*BoardSize - black - white
+	switch {
+	case black > white:
+		black += empty
+	case white > black:
+		white += empty
+	}
+	return black, white
+}
+
+// Winner returns the color with more discs, or Empty for a draw.
+func (b *Board) Winner() Disc {
+	black, white := b.Score()
+	switch {
+	case black > white:
+		return Black
+	case white > black:
+		return White
+	}
+	return Empty
+}
+
+// String encodes the board as 64 characters, row by row:
+// 'X' for black, 'O' for white and '-' for an empty square.
+func (b Board) String() string {
+	var sb strings.Builder
+	sb.Grow(BoardSize * BoardSize)
+	for sq := 0; sq < BoardSize*BoardSize; sq++ {
+		switch b.At(sq) {
+		case Black:
+			sb.WriteByte('X')
+		case White:
+			sb.WriteByte('O')
+		default:
+			sb.WriteByte('-')
+		}
+	}
+	return sb.String()
+}
+
+// ParseBoard is the inverse of Board.String.
+func ParseBoard(s string) (Board, error) {
+	var b Board
+	if len(s) != BoardSize*BoardSize {
+		return b, fmt.Errorf("board must be %d characters, got %d", BoardSize*BoardSize, len(s))
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 'X', 'x', '*':
+			b.black |= 1 << i
+		case 'O', 'o':
+			b.white |= 1 << i
+		case '-', '.':
+		default:
+			return b, fmt.Errorf("invalid board character %q at %d", s[i], i)
+		}
+	}
+	return b, nil
+}
+
+// SquareNames converts a list of square indexes to algebraic names.
+func SquareNames(squares []int) []string {
+	out := make([]string, 0, len(squares))
+	for _, sq := range squares {
+		out = append(out, SquareName(sq))
+	}
+	return out
+}
+
+// Position is a board plus the side to move. It is the unit the rest of the
+// server works with: it applies moves, handles forced passes and detects the
+// end of the game.
+type Position struct {
+	Board  Board
+	ToMove Disc // Empty once the game is over
+}
+
+// MoveResult describes what happened when a move was played.
+type MoveResult struct {
+	Color    Disc
+	Square   int
+	Flipped  []int
+	Passed   bool // the opponent had no reply, so Color moves again
+	GameOver bool
+}
+
+// NewPosition returns the starting position with black to move.
+func NewPosition() Position {
+	return Position{Board: NewBoard(), ToMove: Black}
+}
+
+// Play applies a move for the side to move. After the move the turn passes
+// to the opponent, unless the opponent has no legal move (a pass), in which
+// case the same side moves again. If neither side can move the game is over
+// and ToMove becomes Empty.
+func (p *Position) Play(sq int) (MoveResult, error) {
+	if p.ToMove == Empty {
+		return MoveResult{}, ErrGameOver
+	}
+	mover := p.ToMove
+	flipped, err := p.Board.Play(mover, sq)
+	if err != nil {
+		return MoveResult{}, err
+	}
+
+	res := MoveResult{Color: mover, Square: sq, Flipped: flipped}
+	switch {
+	case p.Board.HasLegalMove(mover.Opponent()):
+		p.ToMove = mover.Opponent()
+	case p.Board.HasLegalMove(mover):
+		res.Passed = true
+	default:
+		p.ToMove = Empty
+		res.GameOver = true
+	}
+	return res, nil
+}
+
+// LegalMoves returns the legal moves for the side to move.
+func (p *Position) LegalMoves() []int {
+	if p.ToMove == Empty {
+		return nil
+	}
+	return p.Board.LegalMoves(p.ToMove)
+}
+
+// IsGameOver reports whether the game has ended.
+func (p *Position) IsGameOver() bool {
+	return p.ToMove == Empty
+}
@@ -0,0 +1,34 @@
+package business_logic
+
+import "math/bits"
+
+// Perft counts the leaf nodes of the move tree below b, with color to move,
+// to the given depth. A forced pass counts as a move, and a finished game
+// counts as a single leaf however much depth is left. These are the usual
+// conventions for Othello perft, so the results can be compared with the
+// published counts (see perft_test.go).
+func Perft(b Board, color Disc, depth int) uint64 {
+	if depth == 0 {
+		return 1
+	}
+	moves := b.LegalMask(color)
+	if moves == 0 {
+		if !b.HasLegalMove(color.Opponent()) {
+			return 1
+		}
+		return Perft(b, color.Opponent(), depth-1)
+	}
+	if depth == 1 {
+		return uint64(bits.OnesCount64(moves))
+	}
+
+	var nodes uint64
+	for moves != 0 {
+		sq := bits.TrailingZeros64(moves)
+		moves &= moves - 1
+		child := b
+		child.apply(color, sq, child.flipMask(color, sq))
+		nodes += Perft(child, color.Opponent(), depth-1)
+	}
+	return nodes
+}
@@ -0,0 +1,36 @@
+package business_logic
+
+import "testing"
+
+// perftCounts are the published perft counts from the standard starting
+// position; perftCounts[d] is the count at depth d.
+var perftCounts = []uint64{
+	1,
+	4,
+	12,
+	56,
+	244,
+	1396,
+	8200,
+	55092,
+	390216,
+	3005288,
+	24571284,
+	212258800,
+	1939886636,
+}
+
+// perftShortDepth is the deepest perft run with -short.
+const perftShortDepth = 9
+
+func TestPerft(t *testing.T) {
+	for depth, want := range perftCounts {
+		if depth > perftShortDepth && testing.Short() {
+			t.Logf("skipping depth %d and beyond in short mode", depth)
+			break
+		}
+		if got := Perft(NewBoard(), Black, depth); got != want {
+			t.Errorf("Perft(%d) = %d, want %d", depth, got, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package business_logic
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"othello/data_access"
+)
+
+// Glicko-2 parameters. New players start at DefaultRating with a wide
+// deviation; tau limits how fast volatility can change.
+const (
+	DefaultRating     = 1500.0
+	DefaultRD         = 350.0
+	DefaultVolatility = 0.06
+	glickoTau         = 0.5
+	glickoScale       = 173.7178 // converts between the Glicko and Glicko-2 scales
+	glickoEpsilon     = 0.000001
+	minRD             = 30.0
+)
+
+// Glicko is a Glicko-2 rating: the rating itself, its deviation (how
+// uncertain it is) and volatility (how erratic the player's results are).
+type Glicko struct {
+	Rating     float64
+	RD         float64
+	Volatility float64
+}
+
+// NewGlicko returns the rating of a player who has never played.
+func NewGlicko() Glicko {
+	return Glicko{Rating: DefaultRating, RD: DefaultRD, Volatility: DefaultVolatility}
+}
+
+// GlickoUpdate returns a player's new rating after one game against
+// opponent. score is 1 for a win, 0.5 for a draw and 0 for a loss. Each game
+// is treated as its own rating period, as most online servers do.
+func GlickoUpdate(player, opponent Glicko, score float64) Glicko {
+	mu := (player.Rating - DefaultRating) / glickoScale
+	phi := player.RD / glickoScale
+	muJ := (opponent.Rating - DefaultRating) / glickoScale
+	phiJ := opponent.RD / glickoScale
+
+	g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+	e := 1 / (1 + math.Exp(-g*(mu-muJ)))
+	v := 1 / (g * g * e * (1 - e))
+	delta := v * g * (score - e)
+
+	// New volatility, found with the Illinois variant of regula falsi.
+	sigma := player.Volatility
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(glickoTau*glickoTau)
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		B = a - k*glickoTau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	newSigma := math.Exp(A / 2)
+
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*g*(score-e)
+
+	return Glicko{
+		Rating:     glickoScale*newMu + DefaultRating,
+		RD:         math.Max(minRD, math.Min(DefaultRD, glickoScale*newPhi)),
+		Volatility: newSigma,
+	}
+}
+
+// newRating returns the rating row of a player with no rated games in a
+// category.
+func newRating(username, category string) data_access.PlayerRating {
+	g := NewGlicko()
+	return data_access.PlayerRating{
+		Username:   username,
+		Category:   category,
+		Rating:     g.Rating,
+		RD:         g.RD,
+		Volatility: g.Volatility,
+	}
+}
+
+// loadRating returns a player's stored rating row, or a fresh one.
+func loadRating(ctx context.Context, username, category string) (data_access.PlayerRating, error) {
+	r, ok, err := data_access.GetRating(ctx, username, category)
+	if err != nil {
+		return data_access.PlayerRating{}, err
+	}
+	if !ok {
+		r = newRating(username, category)
+	}
+	return r, nil
+}
+
+// PlayerRating returns a player's rating in a time-control category, or
+// DefaultRating if they have no rated games in it (or it cannot be read).
+func PlayerRating(username, category string) float64 {
+	r, err := loadRating(context.Background(), username, category)
+	if err != nil {
+		return DefaultRating
+	}
+	return r.Rating
+}
+
+// RateGame updates both players' ratings for a finished rated game and
+// records the change in their rating history. Unrated or unfinished games
+// are ignored.
+func RateGame(g data_access.Game) error {
+	if !g.Rated || g.Status != data_access.GameFinished || g.Black == "" || g.White == "" {
+		return nil
+	}
+	var blackScore float64
+	switch g.Result {
+	case "black":
+		blackScore = 1
+	case "white":
+		blackScore = 0
+	case "draw":
+		blackScore = 0.5
+	default:
+		return fmt.Errorf("game %d has no result to rate", g.ID)
+	}
+
+	// The players' current ratings are read inside the same transaction
+	// that stores the new ones, so concurrent games cannot lose an update.
+	category := TimeControlCategory(g.TimeControl)
+	fresh := []data_access.PlayerRating{newRating(g.Black, category), newRating(g.White, category)}
+	return data_access.SaveGameRatings(context.Background(), g.ID, fresh, func(current []data_access.PlayerRating) ([]data_access.PlayerRating, []float64) {
+		return rateGame(current[0], current[1], blackScore)
+	})
+}
+
+// rateGame returns the black and white players' rating rows after a game
+// with the given score for black, and their rating changes.
+func rateGame(black, white data_access.PlayerRating, blackScore float64) ([]data_access.PlayerRating, []float64) {
+	bg := Glicko{black.Rating, black.RD, black.Volatility}
+	wg := Glicko{white.Rating, white.RD, white.Volatility}
+	newBlack := GlickoUpdate(bg, wg, blackScore)
+	newWhite := GlickoUpdate(wg, bg, 1-blackScore)
+
+	rows := []data_access.PlayerRating{black, white}
+	changes := []float64{newBlack.Rating - black.Rating, newWhite.Rating - white.Rating}
+	for i, ng := range []Glicko{newBlack, newWhite} {
+		score := blackScore
+		if i == 1 {
+			score = 1 - blackScore
+		}
+		r := &rows[i]
+		r.Rating, r.RD, r.Volatility = ng.Rating, ng.RD, ng.Volatility
+		r.GamesPlayed++
+		switch score {
+		case 1:
+			r.Wins++
+		case 0:
+			r.Losses++
+		default:
+			r.Draws++
+		}
+	}
+	return rows, changes
+}
@@ -0,0 +1,132 @@
+package business_logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeControl describes how much thinking time each side gets.
+// The zero value means the game is untimed. At most one of Increment and
+// Delay is set; with neither the game is sudden death.
+type TimeControl struct {
+	Base      time.Duration // starting time on each clock
+	Increment time.Duration // Fischer: added to the mover's clock after every move
+	Delay     time.Duration // simple delay: time at the start of each turn that is not deducted
+}
+
+// Clock modes, as reported by TimeControl.Mode.
+const (
+	ClockUntimed     = "untimed"
+	ClockSuddenDeath = "suddenDeath"
+	ClockFischer     = "fischer"
+	ClockSimpleDelay = "delay"
+)
+
+// Time-control categories, used to keep separate ratings and queues for
+// fast and slow games.
+const (
+	CategoryUntimed   = "untimed"
+	CategoryBullet    = "bullet"
+	CategoryBlitz     = "blitz"
+	CategoryRapid     = "rapid"
+	CategoryClassical = "classical"
+)
+
+// ParseTimeControl parses the usual "minutes+seconds" notation:
+// "5+3" is five minutes with a three second increment, "10" is ten minutes
+// sudden death, and "5d3" is five minutes with a three second simple delay.
+// An empty string or "-" is an untimed game.
+func ParseTimeControl(s string) (TimeControl, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-" {
+		return TimeControl{}, nil
+	}
+
+	sep := "+"
+	if strings.Contains(s, "d") {
+		sep = "d"
+	}
+	baseStr, extraStr, hasExtra := strings.Cut(s, sep)
+	minutes, err := strconv.ParseFloat(baseStr, 64)
+	// Written so NaN, which ParseFloat accepts, fails the range check too.
+	if err != nil || !(minutes > 0 && minutes <= 180) {
+		return TimeControl{}, fmt.Errorf("invalid time control %q: base must be more than 0 and at most 180 minutes", s)
+	}
+	tc := TimeControl{Base: time.Duration(minutes * float64(time.Minute))}
+	if hasExtra {
+		seconds, err := strconv.Atoi(extraStr)
+		if err != nil || seconds < 0 || seconds > 180 {
+			return TimeControl{}, fmt.Errorf("invalid time control %q: increment or delay must be 0-180 seconds", s)
+		}
+		if sep == "d" {
+			tc.Delay = time.Duration(seconds) * time.Second
+		} else {
+			tc.Increment = time.Duration(seconds) * time.Second
+		}
+	}
+	return tc, nil
+}
+
+// IsUntimed reports whether the game has no clock.
+func (tc TimeControl) IsUntimed() bool {
+	return tc.Base == 0
+}
+
+// Mode reports which kind of clock the time control uses.
+func (tc TimeControl) Mode() string {
+	switch {
+	case tc.IsUntimed():
+		return ClockUntimed
+	case tc.Delay > 0:
+		return ClockSimpleDelay
+	case tc.Increment > 0:
+		return ClockFischer
+	}
+	return ClockSuddenDeath
+}
+
+// String formats the time control in the notation ParseTimeControl reads.
+func (tc TimeControl) String() string {
+	if tc.IsUntimed() {
+		return ""
+	}
+	base := strconv.FormatFloat(tc.Base.Minutes(), 'f', -1, 64)
+	switch {
+	case tc.Delay > 0:
+		return fmt.Sprintf("%sd%d", base, int(tc.Delay/time.Second))
+	case tc.Increment > 0:
+		return fmt.Sprintf("%s+%d", base, int(tc.Increment/time.Second))
+	}
+	return base
+}
+
+// Category buckets a time control by its estimated game length, assuming
+// each side makes about 30 moves. A delay counts like an increment, since
+// it is the most a move can save.
+func (tc TimeControl) Category() string {
+	if tc.IsUntimed() {
+		return CategoryUntimed
+	}
+	estimate := tc.Base + 30*(tc.Increment+tc.Delay)
+	switch {
+	case estimate < 3*time.Minute:
+		return CategoryBullet
+	case estimate < 8*time.Minute:
+		return CategoryBlitz
+	case estimate < 25*time.Minute:
+		return CategoryRapid
+	}
+	return CategoryClassical
+}
+
+// TimeControlCategory returns the category for a stored time-control string.
+// Unparseable strings are treated as untimed.
+func TimeControlCategory(s string) string {
+	tc, err := ParseTimeControl(s)
+	if err != nil {
+		return CategoryUntimed
+	}
+	return tc.Category()
+}
@@ -0,0 +1,45 @@
+package business_logic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    TimeControl
+		wantErr bool
+	}{
+		{in: "", want: TimeControl{}},
+		{in: "-", want: TimeControl{}},
+		{in: "10", want: TimeControl{Base: 10 * time.Minute}},
+		{in: "5+3", want: TimeControl{Base: 5 * time.Minute, Increment: 3 * time.Second}},
+		{in: "5d3", want: TimeControl{Base: 5 * time.Minute, Delay: 3 * time.Second}},
+		{in: "0.5+0", want: TimeControl{Base: 30 * time.Second}},
+		{in: "180", want: TimeControl{Base: 180 * time.Minute}},
+		{in: "0", wantErr: true},
+		{in: "-5", wantErr: true},
+		{in: "181", wantErr: true},
+		{in: "5+181", wantErr: true},
+		{in: "5+-1", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "NaN+5", wantErr: true},
+		{in: "Inf+5", wantErr: true},
+		{in: "-Inf", wantErr: true},
+		{in: "+Inf", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeControl(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTimeControl(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTimeControl(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
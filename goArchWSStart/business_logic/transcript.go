@@ -0,0 +1,257 @@
+package business_logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"othello/data_access"
+)
+
+// Games are exchanged in two text formats:
+//
+//   - a bare move list, the squares run together: "f5d6c3d3c4..."
+//   - a transcript: PGN-style [Key "Value"] header lines, a blank line, then
+//     the move list.
+//
+// Passes are implicit in both, as they are in the stored move list; a pass
+// may still be written as "pa", "ps" or "--" where one is forced.
+
+// ErrBadTranscript is returned for transcripts that cannot be imported.
+var ErrBadTranscript = errors.New("invalid transcript")
+
+// transcriptDate is the layout of the Date header.
+const transcriptDate = "2006.01.02"
+
+// Transcript header keys, in the order they are written.
+var transcriptKeys = []string{
+	"Event", "Date", "Black", "White", "BlackRating", "WhiteRating",
+	"TimeControl", "Result", "Score", "Termination",
+}
+
+// unknownPlayer stands in for a player a transcript does not name.
+const unknownPlayer = "?"
+
+// movesPerLine is how many moves ExportTranscript puts on each line.
+const movesPerLine = 20
+
+// FormatMoveList renders moves as a bare move list, e.g. "f5d6c3".
+func FormatMoveList(moves []data_access.Move) string {
+	var sb strings.Builder
+	for _, m := range moves {
+		sb.WriteString(m.Square)
+	}
+	return sb.String()
+}
+
+// ExportTranscript renders a game with its headers. Ratings are the players'
+// ratings going into the game and are only given for rated games. An
+// unfinished game has the result "*".
+func ExportTranscript(g data_access.Game) (string, error) {
+	headers := map[string]string{
+		"Event":       "Casual game",
+		"Date":        g.CreatedAt.Format(transcriptDate),
+		"Black":       g.Black,
+		"White":       g.White,
+		"TimeControl": g.TimeControl,
+		"Result":      "*",
+	}
+	switch {
+	case g.Imported:
+		headers["Event"] = "Imported game"
+	case g.Rated:
+		headers["Event"] = "Rated game"
+		ratings, err := data_access.GetGameRatings(context.Background(), g.ID)
+		if err != nil {
+			return "", err
+		}
+		if h, ok := ratings[g.Black]; ok {
+			headers["BlackRating"] = fmt.Sprintf("%.0f", h.Rating-h.Change)
+		}
+		if h, ok := ratings[g.White]; ok {
+			headers["WhiteRating"] = fmt.Sprintf("%.0f", h.Rating-h.Change)
+		}
+	}
+	if g.TimeControl == "" {
+		headers["TimeControl"] = "-"
+	}
+	if gameEnded(g) && g.Result != "" {
+		headers["Result"] = g.Result
+		headers["Termination"] = g.ResultReason
+		if board, err := ParseBoard(g.Board); err == nil {
+			black, white := board.Count()
+			if g.ResultReason == ReasonScore {
+				black, white = board.Score()
+			}
+			headers["Score"] = fmt.Sprintf("%d-%d", black, white)
+		}
+	}
+
+	var sb strings.Builder
+	for _, key := range transcriptKeys {
+		if v, ok := headers[key]; ok {
+			fmt.Fprintf(&sb, "[%s \"%s\"]\n", key, headerEscaper.Replace(v))
+		}
+	}
+	sb.WriteString("\n")
+	for i := 0; i < len(g.Moves); i += movesPerLine {
+		sb.WriteString(FormatMoveList(g.Moves[i:min(i+movesPerLine, len(g.Moves))]))
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+var (
+	headerLine      = regexp.MustCompile(`^\[([A-Za-z]+)\s+"((?:[^"\\]|\\.)*)"\]$`)
+	moveNumbers     = regexp.MustCompile(`(^|\s)\d+\.+`)
+	headerEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	headerUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+)
+
+// ParseTranscript splits a transcript into its headers and its moves, in
+// order. A bare move list parses as a transcript without headers. The moves
+// are only checked for form here; ImportTranscript checks they are legal.
+func ParseTranscript(text string) (map[string]string, []string, error) {
+	headers := make(map[string]string)
+	var moveText strings.Builder
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			moveText.WriteString(line)
+			moveText.WriteString(" ")
+			continue
+		}
+		m := headerLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, nil, fmt.Errorf("%w: line %d: malformed header", ErrBadTranscript, n+1)
+		}
+		headers[m[1]] = headerUnescaper.Replace(m[2])
+	}
+
+	// Move numbers ("1. f5 d6 2. c3") and spacing are optional.
+	s := moveNumbers.ReplaceAllString(moveText.String(), " ")
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	s = strings.ReplaceAll(s, "pass", "pa")
+	if len(s)%2 != 0 {
+		return nil, nil, fmt.Errorf("%w: move list has an odd number of characters", ErrBadTranscript)
+	}
+	moves := make([]string, 0, len(s)/2)
+	for i := 0; i < len(s); i += 2 {
+		moves = append(moves, s[i:i+2])
+	}
+	return headers, moves, nil
+}
+
+// isPassToken reports whether a move-list entry is a written pass.
+func isPassToken(move string) bool {
+	return move == "pa" || move == "ps" || move == "--"
+}
+
+// ImportTranscript replays a transcript under the full rules and stores it
+// as a finished, unrated game. Every move must be legal. If the moves play
+// the game out, the result is taken from the board and a Result header must
+// agree with it; otherwise the Result and Termination headers must say how
+// the game ended (resignation or timeout for a win, agreement for a draw).
+func ImportTranscript(text string) (data_access.Game, error) {
+	headers, moves, err := ParseTranscript(text)
+	if err != nil {
+		return data_access.Game{}, err
+	}
+	if len(moves) == 0 {
+		return data_access.Game{}, fmt.Errorf("%w: no moves", ErrBadTranscript)
+	}
+
+	g := data_access.Game{
+		Black:  headers["Black"],
+		White:  headers["White"],
+		Status: data_access.GameFinished,
+	}
+	for _, name := range []*string{&g.Black, &g.White} {
+		if *name == "" {
+			*name = unknownPlayer
+		}
+		if len(*name) > 50 {
+			return data_access.Game{}, fmt.Errorf("%w: player names are at most 50 characters", ErrBadTranscript)
+		}
+	}
+	if tcText := headers["TimeControl"]; tcText != "" && tcText != "-" {
+		tc, err := ParseTimeControl(tcText)
+		if err != nil {
+			return data_access.Game{}, fmt.Errorf("%w: %v", ErrBadTranscript, err)
+		}
+		g.TimeControl = tc.String()
+	}
+	g.CreatedAt = time.Now()
+	if d := headers["Date"]; d != "" && !strings.Contains(d, "?") {
+		if g.CreatedAt, err = time.Parse(transcriptDate, d); err != nil {
+			return data_access.Game{}, fmt.Errorf("%w: Date must look like 2024.03.15", ErrBadTranscript)
+		}
+	}
+	g.FinishedAt = g.CreatedAt
+
+	p := NewPosition()
+	passed := false
+	for i, sq := range moves {
+		if isPassToken(sq) {
+			if !passed {
+				return data_access.Game{}, fmt.Errorf("%w: move %d: pass when a move was available", ErrBadTranscript, i+1)
+			}
+			passed = false
+			continue
+		}
+		color := p.ToMove
+		res, err := ApplyMove(&p, color, sq)
+		if err != nil {
+			return data_access.Game{}, fmt.Errorf("%w: move %d (%s): %v", ErrBadTranscript, i+1, sq, err)
+		}
+		passed = res.Passed
+		g.Moves = append(g.Moves, data_access.Move{
+			Ply:      len(g.Moves) + 1,
+			Color:    color.String(),
+			Square:   SquareName(res.Square),
+			PlayedAt: g.CreatedAt,
+		})
+	}
+	g.Board = p.Board.String()
+
+	result := headers["Result"]
+	if result == "*" {
+		result = ""
+	}
+	if p.IsGameOver() {
+		g.Result = p.Board.Winner().String()
+		if g.Result == Empty.String() {
+			g.Result = "draw"
+		}
+		g.ResultReason = ReasonScore
+		if result != "" && result != g.Result {
+			return data_access.Game{}, fmt.Errorf("%w: Result %q does not match the final position (%s)", ErrBadTranscript, result, g.Result)
+		}
+	} else {
+		if err := checkUnplayedResult(result, headers["Termination"]); err != nil {
+			return data_access.Game{}, err
+		}
+		g.Result, g.ResultReason = result, headers["Termination"]
+	}
+
+	return data_access.ImportGame(context.Background(), g)
+}
+
+// checkUnplayedResult validates the stated result of a game that was not
+// played to the end.
+func checkUnplayedResult(result, reason string) error {
+	switch {
+	case result == "":
+		return fmt.Errorf("%w: the game is not over, so a Result header is required", ErrBadTranscript)
+	case result == "draw" && reason == ReasonAgreement:
+		return nil
+	case (result == "black" || result == "white") && (reason == ReasonResignation || reason == ReasonTimeout):
+		return nil
+	case result != "black" && result != "white" && result != "draw":
+		return fmt.Errorf("%w: Result must be black, white, draw or *", ErrBadTranscript)
+	}
+	return fmt.Errorf("%w: a game that is not over cannot end %q by %q", ErrBadTranscript, result, reason)
+}
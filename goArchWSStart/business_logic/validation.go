@@ -1,12 +1,27 @@
 package business_logic
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-// ValidateUsername checks if a username is valid (non-empty)
+// ComputerPrefix starts the username of every computer player, e.g.
+// "computer:medium". Real accounts may not use it.
+const ComputerPrefix = "computer:"
+
+// IsComputerPlayer reports whether a seated username is a computer player.
+func IsComputerPlayer(username string) bool {
+	return strings.HasPrefix(username, ComputerPrefix)
+}
+
+// ValidateUsername checks if a username is valid (non-empty, not reserved)
 func ValidateUsername(username string) error {
 	if username == "" {
 		return fmt.Errorf("username cannot be empty")
 	}
+	if IsComputerPlayer(username) {
+		return fmt.Errorf("usernames starting with %q are reserved", ComputerPrefix)
+	}
 	return nil
 }
 
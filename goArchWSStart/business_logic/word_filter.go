@@ -0,0 +1,108 @@
+package business_logic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// Word filter modes.
+const (
+	FilterMask   = "mask"   // filtered words are replaced with asterisks
+	FilterReject = "reject" // messages containing one are refused
+)
+
+// ErrFilteredWord is returned for a message the word filter rejects.
+var ErrFilteredWord = errors.New("message contains a word that is not allowed")
+
+// WordFilter masks or rejects chat messages containing any of a list of
+// words. Words match whole words, ignoring case. The zero value filters
+// nothing.
+type WordFilter struct {
+	words map[string]bool // lower-cased
+	mode  string
+}
+
+// NewWordFilter returns a filter for the given words in the given mode
+// (FilterMask if empty).
+func NewWordFilter(words []string, mode string) (WordFilter, error) {
+	if mode == "" {
+		mode = FilterMask
+	}
+	if mode != FilterMask && mode != FilterReject {
+		return WordFilter{}, fmt.Errorf("word filter mode must be %q or %q, not %q", FilterMask, FilterReject, mode)
+	}
+	f := WordFilter{words: make(map[string]bool), mode: mode}
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			f.words[w] = true
+		}
+	}
+	return f, nil
+}
+
+// WordFilterFromEnv builds the chat word filter from CHAT_WORD_FILTER, a
+// comma-separated list of words, and CHAT_WORD_FILTER_MODE, "mask" (the
+// default) or "reject". getenv is usually os.Getenv.
+func WordFilterFromEnv(getenv func(string) string) (WordFilter, error) {
+	return NewWordFilter(strings.Split(getenv("CHAT_WORD_FILTER"), ","), getenv("CHAT_WORD_FILTER_MODE"))
+}
+
+// Apply returns text with the filtered words masked, or ErrFilteredWord in
+// reject mode.
+func (f WordFilter) Apply(text string) (string, error) {
+	if len(f.words) == 0 {
+		return text, nil
+	}
+	var b strings.Builder
+	rest := text
+	for rest != "" {
+		// Copy up to the next word, then the word itself, masked if filtered.
+		start := strings.IndexFunc(rest, isWordRune)
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:start])
+		rest = rest[start:]
+		end := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+		if !f.words[strings.ToLower(word)] {
+			b.WriteString(word)
+			continue
+		}
+		if f.mode == FilterReject {
+			return "", ErrFilteredWord
+		}
+		b.WriteString(strings.Repeat("*", len([]rune(word))))
+	}
+	return b.String(), nil
+}
+
+// isWordRune reports whether r can be part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// chatFilter is the word filter applied to every chat message.
+var chatFilter atomic.Pointer[WordFilter]
+
+// SetChatWordFilter sets the word filter applied to chat messages.
+func SetChatWordFilter(f WordFilter) {
+	chatFilter.Store(&f)
+}
+
+// filterChatText applies the chat word filter, if one is set.
+func filterChatText(text string) (string, error) {
+	f := chatFilter.Load()
+	if f == nil {
+		return text, nil
+	}
+	return f.Apply(text)
+}
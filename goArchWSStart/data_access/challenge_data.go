@@ -0,0 +1,84 @@
+package data_access
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrChallengeNotFound is returned when a challenge does not exist (or was
+// already accepted, declined, cancelled or expired).
+var ErrChallengeNotFound = errors.New("challenge not found")
+
+// Challenge is a pending game offer. To is empty for an open seek that any
+// lobby user may accept.
+type Challenge struct {
+	ID          string
+	From        string
+	To          string
+	Color       string // color requested by the challenger: "black", "white" or "random"
+	TimeControl string // "" for an untimed game
+	Rated       bool
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Pending challenges only live in memory; they are short-lived and have no
+// value after a restart.
+var (
+	challengesMu sync.RWMutex
+	challenges   = make(map[string]Challenge)
+)
+
+// SaveChallenge stores a new pending challenge.
+func SaveChallenge(c Challenge) {
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+	challenges[c.ID] = c
+}
+
+// GetChallenge returns a pending challenge by ID.
+func GetChallenge(id string) (Challenge, error) {
+	challengesMu.RLock()
+	defer challengesMu.RUnlock()
+	c, ok := challenges[id]
+	if !ok {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	return c, nil
+}
+
+// TakeChallenge removes a challenge if check approves it, and returns it.
+// Because the lookup, check and delete happen under one lock, two users
+// accepting the same open seek cannot both succeed.
+func TakeChallenge(id string, check func(c Challenge) error) (Challenge, error) {
+	challengesMu.Lock()
+	defer challengesMu.Unlock()
+	c, ok := challenges[id]
+	if !ok {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	if check != nil {
+		if err := check(c); err != nil {
+			return c, err
+		}
+	}
+	delete(challenges, id)
+	return c, nil
+}
+
+// ListChallenges returns the pending challenges a user can see: those they
+// sent, those sent to them, and every open seek. Oldest first.
+func ListChallenges(username string) []Challenge {
+	challengesMu.RLock()
+	defer challengesMu.RUnlock()
+	var out []Challenge
+	for _, c := range challenges {
+		if c.From == username || c.To == username || c.To == "" {
+			out = append(out, c)
+		}
+	}
+	slices.SortFunc(out, func(a, b Challenge) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out
+}
@@ -1,80 +1,290 @@
-package data_access
-
-import (
-	"context"
-	"database/sql"
-	"time"
-)
-
-// ChatMessage represents a row in the chat table.
-type ChatMessage struct {
-	Account_Token string
-	Username      string
-	Message       string
-	Chat_Date     time.Time
-}
-
-// returns the most recent messages (limit controlled).
-func GetMessages(ctx context.Context, limit int) ([]ChatMessage, error) {
-	if DB == nil {
-		return nil, sql.ErrConnDone
-	}
-	if limit <= 0 {
-		limit = 100
-	}
-
-	rows, err := DB.QueryContext(ctx,
-		`SELECT account_token, username, message, chat_date
-         FROM 442Chat
-         ORDER BY chat_date DESC
-         LIMIT ?`, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var out []ChatMessage
-	for rows.Next() {
-		var m ChatMessage
-		if err := rows.Scan(&m.Account_Token, &m.Username, &m.Message, &m.Chat_Date); err != nil {
-			return nil, err
-		}
-		out = append(out, m)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return out, nil
-}
-
-// InsertMessage inserts a new chat message and returns the inserted ID.
-func InsertMessage(ctx context.Context, accountToken, username, message string) (int64, error) {
-	if DB == nil {
-		return 0, sql.ErrConnDone
-	}
-	res, err := DB.ExecContext(ctx,
-		`INSERT INTO 442Chat (account_token, username, message) VALUES (?, ?, ?)`,
-		accountToken, username, message)
-	if err != nil {
-		return 0, err
-	}
-	return res.LastInsertId()
-}
-
-// UpdateMessage updates the text of an existing message.
-func UpdateMessageByAccountAndDate(ctx context.Context, accountToken string, chatDate string, newText string) error {
-	if DB == nil {
-		return sql.ErrConnDone
-	}
-	_, err := DB.ExecContext(ctx, `UPDATE 442Chat SET message = ? WHERE account_token = ? AND chat_date = ?`, newText, accountToken, chatDate)
-	return err
-}
-
-// DeleteMessage removes a message by id.
-func DeleteMessageByAccountAndDate(ctx context.Context, accountToken string, chatDate string) error {
-	if DB == nil {
-		return sql.ErrConnDone
-	}
-	_, err := DB.ExecContext(ctx, `DELETE FROM 442Chat WHERE account_token = ? AND chat_date = ?`, accountToken, chatDate)
-	return err
-}
+package data_access
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ChatMessage represents a row in the chat table.
+type ChatMessage struct {
+	Message_ID    int64
+	Room_ID       string
+	Account_Token string
+	Username      string
+	Message       string
+	Chat_Date     time.Time
+	Edited_At     time.Time // zero if the message was never edited
+}
+
+// ErrChatMessageNotFound is returned when no chat message has the given ID.
+var ErrChatMessageNotFound = errors.New("chat message not found")
+
+// In-memory fallback used when no DB is configured.
+var (
+	chatMu     sync.RWMutex
+	inMemChat  []ChatMessage // in ID order
+	nextChatID int64         = 1
+)
+
+// chatColumns are the 442Chat columns read by scanChat, in order.
+const chatColumns = "message_id, room_id, account_token, username, message, chat_date, edited_at"
+
+// scanChat reads one row selected with chatColumns.
+func scanChat(row interface{ Scan(...any) error }) (ChatMessage, error) {
+	var m ChatMessage
+	var edited sql.NullTime
+	if err := row.Scan(&m.Message_ID, &m.Room_ID, &m.Account_Token, &m.Username, &m.Message, &m.Chat_Date, &edited); err != nil {
+		return ChatMessage{}, err
+	}
+	if edited.Valid {
+		m.Edited_At = edited.Time
+	}
+	return m, nil
+}
+
+// returns the most recent messages of one chat room (limit controlled).
+func GetMessages(ctx context.Context, roomID string, limit int) ([]ChatMessage, error) {
+	return GetMessagePage(ctx, roomID, 0, 0, limit)
+}
+
+// GetMessagePage returns one page of a chat room's messages. With afterID
+// set it returns up to limit messages with an ID above it, oldest first;
+// otherwise up to limit messages with an ID below beforeID (0 for the
+// newest), newest first. Both follow idx_chat_room_id, so only the page is
+// read.
+func GetMessagePage(ctx context.Context, roomID string, beforeID, afterID int64, limit int) ([]ChatMessage, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	if DB == nil {
+		chatMu.RLock()
+		defer chatMu.RUnlock()
+		var out []ChatMessage
+		if afterID > 0 {
+			for i := 0; i < len(inMemChat) && len(out) < limit; i++ {
+				if m := inMemChat[i]; m.Room_ID == roomID && m.Message_ID > afterID {
+					out = append(out, m)
+				}
+			}
+			return out, nil
+		}
+		for i := len(inMemChat) - 1; i >= 0 && len(out) < limit; i-- {
+			if m := inMemChat[i]; m.Room_ID == roomID && (beforeID <= 0 || m.Message_ID < beforeID) {
+				out = append(out, m)
+			}
+		}
+		return out, nil
+	}
+
+	query := `SELECT ` + chatColumns + `
+         FROM 442Chat
+         WHERE room_id = ? AND message_id < ?
+         ORDER BY message_id DESC
+         LIMIT ?`
+	cursor := beforeID
+	if afterID > 0 {
+		query = `SELECT ` + chatColumns + `
+         FROM 442Chat
+         WHERE room_id = ? AND message_id > ?
+         ORDER BY message_id ASC
+         LIMIT ?`
+		cursor = afterID
+	} else if beforeID <= 0 {
+		cursor = 1<<63 - 1
+	}
+	rows, err := DB.QueryContext(ctx, query, roomID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ChatMessage
+	for rows.Next() {
+		m, err := scanChat(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMessage returns one chat message by ID.
+func GetMessage(ctx context.Context, id int64) (ChatMessage, error) {
+	if DB == nil {
+		chatMu.RLock()
+		defer chatMu.RUnlock()
+		if i := inMemChatIndex(id); i >= 0 {
+			return inMemChat[i], nil
+		}
+		return ChatMessage{}, ErrChatMessageNotFound
+	}
+
+	m, err := scanChat(DB.QueryRowContext(ctx, `SELECT `+chatColumns+` FROM 442Chat WHERE message_id = ?`, id))
+	if err == sql.ErrNoRows {
+		return ChatMessage{}, ErrChatMessageNotFound
+	}
+	return m, err
+}
+
+// inMemChatIndex returns the index of a message in inMemChat, or -1. The
+// caller holds chatMu.
+func inMemChatIndex(id int64) int {
+	for i := range inMemChat {
+		if inMemChat[i].Message_ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// InsertMessage inserts a new chat message into a room and returns it with
+// its ID and date set.
+func InsertMessage(ctx context.Context, roomID, accountToken, username, message string) (ChatMessage, error) {
+	m := ChatMessage{
+		Room_ID:       roomID,
+		Account_Token: accountToken,
+		Username:      username,
+		Message:       message,
+		Chat_Date:     time.Now().Truncate(time.Second),
+	}
+
+	if DB == nil {
+		chatMu.Lock()
+		defer chatMu.Unlock()
+		m.Message_ID = nextChatID
+		nextChatID++
+		inMemChat = append(inMemChat, m)
+		return m, nil
+	}
+
+	res, err := DB.ExecContext(ctx,
+		`INSERT INTO 442Chat (room_id, account_token, username, message, chat_date) VALUES (?, ?, ?, ?, ?)`,
+		roomID, accountToken, username, message, m.Chat_Date)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	if m.Message_ID, err = res.LastInsertId(); err != nil {
+		return ChatMessage{}, err
+	}
+	return m, nil
+}
+
+// UpdateMessage replaces the text of a message, marks it edited and returns
+// the updated message.
+func UpdateMessage(ctx context.Context, id int64, newText string) (ChatMessage, error) {
+	now := time.Now().Truncate(time.Second)
+	if DB == nil {
+		chatMu.Lock()
+		defer chatMu.Unlock()
+		i := inMemChatIndex(id)
+		if i < 0 {
+			return ChatMessage{}, ErrChatMessageNotFound
+		}
+		inMemChat[i].Message = newText
+		inMemChat[i].Edited_At = now
+		return inMemChat[i], nil
+	}
+
+	res, err := DB.ExecContext(ctx, `UPDATE 442Chat SET message = ?, edited_at = ? WHERE message_id = ?`, newText, now, id)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ChatMessage{}, ErrChatMessageNotFound
+	}
+	return GetMessage(ctx, id)
+}
+
+// DeleteMessage removes a message by id.
+func DeleteMessage(ctx context.Context, id int64) error {
+	if DB == nil {
+		chatMu.Lock()
+		defer chatMu.Unlock()
+		i := inMemChatIndex(id)
+		if i < 0 {
+			return ErrChatMessageNotFound
+		}
+		inMemChat = append(inMemChat[:i], inMemChat[i+1:]...)
+		return nil
+	}
+
+	res, err := DB.ExecContext(ctx, `DELETE FROM 442Chat WHERE message_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrChatMessageNotFound
+	}
+	return nil
+}
+
+// DeleteUserMessages removes every chat message a user wrote, in every room,
+// and returns the messages removed.
+func DeleteUserMessages(ctx context.Context, username string) ([]ChatMessage, error) {
+	if DB == nil {
+		chatMu.Lock()
+		defer chatMu.Unlock()
+		var removed []ChatMessage
+		kept := inMemChat[:0]
+		for _, m := range inMemChat {
+			if m.Username == username {
+				removed = append(removed, m)
+			} else {
+				kept = append(kept, m)
+			}
+		}
+		inMemChat = kept
+		return removed, nil
+	}
+
+	// Read and delete in one transaction, with the rows locked, so the
+	// messages returned (and audited) are exactly the ones deleted, even if
+	// the user edits or deletes one meanwhile.
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+chatColumns+` FROM 442Chat WHERE username = ? FOR UPDATE`, username)
+	if err != nil {
+		return nil, err
+	}
+	var removed []ChatMessage
+	for rows.Next() {
+		m, err := scanChat(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		removed = append(removed, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	// Only what was read above; anything posted since stays.
+	last := removed[0].Message_ID
+	for _, m := range removed {
+		last = max(last, m.Message_ID)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM 442Chat WHERE username = ? AND message_id <= ?`, username, last); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
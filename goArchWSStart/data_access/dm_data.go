@@ -0,0 +1,254 @@
+package data_access
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DirectMessage is one private message from one user to another.
+type DirectMessage struct {
+	ID     int64
+	From   string
+	To     string
+	Body   string
+	SentAt time.Time
+	ReadAt time.Time // zero while unread
+}
+
+// Conversation summarises the messages between a user and one other person.
+type Conversation struct {
+	With   string
+	Last   DirectMessage
+	Unread int // messages from With the user has not read
+}
+
+// In-memory fallback used when no DB is configured.
+var (
+	dmsMu    sync.RWMutex
+	inMemDMs []DirectMessage // in ID order
+	nextDMID int64           = 1
+)
+
+// between reports whether m is part of the conversation between a and b.
+func (m *DirectMessage) between(a, b string) bool {
+	return (m.From == a && m.To == b) || (m.From == b && m.To == a)
+}
+
+// InsertDirectMessage stores a message; ID and SentAt are set here.
+func InsertDirectMessage(ctx context.Context, m DirectMessage) (DirectMessage, error) {
+	m.SentAt = time.Now()
+	m.ReadAt = time.Time{}
+
+	if DB == nil {
+		dmsMu.Lock()
+		defer dmsMu.Unlock()
+		m.ID = nextDMID
+		nextDMID++
+		inMemDMs = append(inMemDMs, m)
+		return m, nil
+	}
+
+	res, err := DB.ExecContext(ctx,
+		"INSERT INTO `442Direct_Message` (Sender, Recipient, Body, Sent_At) VALUES (?, ?, ?, ?)",
+		m.From, m.To, m.Body, m.SentAt)
+	if err != nil {
+		return DirectMessage{}, err
+	}
+	if m.ID, err = res.LastInsertId(); err != nil {
+		return DirectMessage{}, err
+	}
+	return m, nil
+}
+
+// dmColumns are the 442Direct_Message columns read by scanDM, in order.
+const dmColumns = "Message_ID, Sender, Recipient, Body, Sent_At, Read_At"
+
+// scanDM reads one row selected with dmColumns.
+func scanDM(row interface{ Scan(...any) error }) (DirectMessage, error) {
+	var m DirectMessage
+	var read sql.NullTime
+	if err := row.Scan(&m.ID, &m.From, &m.To, &m.Body, &m.SentAt, &read); err != nil {
+		return DirectMessage{}, err
+	}
+	if read.Valid {
+		m.ReadAt = read.Time
+	}
+	return m, nil
+}
+
+// GetConversation returns one page of the messages between two users, newest
+// first: up to limit messages with an ID below beforeID (0 for the newest).
+func GetConversation(ctx context.Context, a, b string, beforeID int64, limit int) ([]DirectMessage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	if DB == nil {
+		dmsMu.RLock()
+		defer dmsMu.RUnlock()
+		var out []DirectMessage
+		for i := len(inMemDMs) - 1; i >= 0 && len(out) < limit; i-- {
+			m := inMemDMs[i]
+			if m.between(a, b) && (beforeID <= 0 || m.ID < beforeID) {
+				out = append(out, m)
+			}
+		}
+		return out, nil
+	}
+
+	if beforeID <= 0 {
+		beforeID = 1<<63 - 1
+	}
+	rows, err := DB.QueryContext(ctx,
+		"SELECT "+dmColumns+" FROM `442Direct_Message` "+
+			"WHERE ((Sender = ? AND Recipient = ?) OR (Sender = ? AND Recipient = ?)) AND Message_ID < ? "+
+			"ORDER BY Message_ID DESC LIMIT ?", a, b, b, a, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DirectMessage
+	for rows.Next() {
+		m, err := scanDM(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ListConversations returns everyone a user has exchanged messages with,
+// most recently active first, with the latest message and the unread count.
+func ListConversations(ctx context.Context, username string) ([]Conversation, error) {
+	byUser := make(map[string]*Conversation)
+	// add files m under the other person, keeping the latest message.
+	add := func(m DirectMessage) *Conversation {
+		other := m.To
+		if m.To == username {
+			other = m.From
+		}
+		c, ok := byUser[other]
+		if !ok {
+			c = &Conversation{With: other}
+			byUser[other] = c
+		}
+		if m.ID > c.Last.ID {
+			c.Last = m
+		}
+		return c
+	}
+
+	if DB == nil {
+		dmsMu.RLock()
+		for _, m := range inMemDMs {
+			if m.From == username || m.To == username {
+				c := add(m)
+				if m.To == username && m.ReadAt.IsZero() {
+					c.Unread++
+				}
+			}
+		}
+		dmsMu.RUnlock()
+	} else {
+		// The latest message of each conversation, then the unread counts.
+		rows, err := DB.QueryContext(ctx,
+			"SELECT "+dmColumns+" FROM `442Direct_Message` WHERE Message_ID IN ("+
+				"SELECT MAX(Message_ID) FROM `442Direct_Message` WHERE Sender = ? OR Recipient = ? "+
+				"GROUP BY IF(Sender = ?, Recipient, Sender))", username, username, username)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			m, err := scanDM(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			add(m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		unread, err := DB.QueryContext(ctx,
+			"SELECT Sender, COUNT(*) FROM `442Direct_Message` WHERE Recipient = ? AND Read_At IS NULL GROUP BY Sender", username)
+		if err != nil {
+			return nil, err
+		}
+		defer unread.Close()
+		for unread.Next() {
+			var from string
+			var n int
+			if err := unread.Scan(&from, &n); err != nil {
+				return nil, err
+			}
+			if c, ok := byUser[from]; ok {
+				c.Unread = n
+			}
+		}
+		if err := unread.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]Conversation, 0, len(byUser))
+	for _, c := range byUser {
+		out = append(out, *c)
+	}
+	slices.SortFunc(out, func(a, b Conversation) int { return cmp.Compare(b.Last.ID, a.Last.ID) })
+	return out, nil
+}
+
+// MarkConversationRead marks every unread message from `from` to reader as
+// read and returns how many there were.
+func MarkConversationRead(ctx context.Context, reader, from string) (int64, error) {
+	now := time.Now()
+	if DB == nil {
+		dmsMu.Lock()
+		defer dmsMu.Unlock()
+		var n int64
+		for i := range inMemDMs {
+			m := &inMemDMs[i]
+			if m.From == from && m.To == reader && m.ReadAt.IsZero() {
+				m.ReadAt = now
+				n++
+			}
+		}
+		return n, nil
+	}
+
+	res, err := DB.ExecContext(ctx,
+		"UPDATE `442Direct_Message` SET Read_At = ? WHERE Recipient = ? AND Sender = ? AND Read_At IS NULL",
+		now, reader, from)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountUnread returns how many direct messages to a user are unread in total.
+func CountUnread(ctx context.Context, username string) (int, error) {
+	if DB == nil {
+		dmsMu.RLock()
+		defer dmsMu.RUnlock()
+		n := 0
+		for _, m := range inMemDMs {
+			if m.To == username && m.ReadAt.IsZero() {
+				n++
+			}
+		}
+		return n, nil
+	}
+
+	var n int
+	err := DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM `442Direct_Message` WHERE Recipient = ? AND Read_At IS NULL", username).Scan(&n)
+	return n, err
+}
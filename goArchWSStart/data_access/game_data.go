@@ -1,15 +1,490 @@
 package data_access
 
-var players = []string{"Alice", "Bob", "Charlie"}
-var currentIndex = 0
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
 
-// Query the database to figure out whose turn it is
-func GetTurn() string {
-	return players[currentIndex]
+// GameStatus is the lifecycle state of a game.
+type GameStatus string
+
+const (
+	GameWaiting  GameStatus = "waiting"  // created, still waiting for a second player
+	GameActive   GameStatus = "active"   // both seats filled, moves being played
+	GameFinished GameStatus = "finished" // no more moves will be accepted
+	GameAborted  GameStatus = "aborted"  // called off early; no result and not rated
+)
+
+// ErrGameNotFound is returned when no game exists with the requested ID.
+var ErrGameNotFound = errors.New("game not found")
+
+// Move is one ply of a game's move history.
+type Move struct {
+	Ply      int    // 1-based
+	Color    string // "black" or "white"
+	Square   string // algebraic, e.g. "f5"
+	PlayedAt time.Time
+	Clock    time.Duration // mover's remaining time after the move; 0 when untimed
+}
+
+// Game is the live state of a single game.
+type Game struct {
+	ID           int64
+	Black        string // username seated as black ("" while the seat is open)
+	White        string // username seated as white ("" while the seat is open)
+	Board        string // 64-character board encoding (see business_logic.Board.String)
+	ToMove       string // "black", "white", or "" once the game is over
+	TimeControl  string // e.g. "5+3"; "" for an untimed game
+	Rated        bool
+	Imported     bool // entered from a transcript rather than played here
+	Status       GameStatus
+	Result       string // "black", "white" or "draw" once finished
+	ResultReason string // how it finished, e.g. "score", "resignation", "timeout"
+	Moves        []Move
+	CreatedAt    time.Time
+	FinishedAt   time.Time // zero until the game finishes
+
+	// Clocks of a timed game: each side's remaining time as of the start of
+	// the current turn, and when that turn started. ClockStarted is zero
+	// while no clock is running (before the first move and after the end).
+	BlackClock   time.Duration
+	WhiteClock   time.Duration
+	ClockStarted time.Time
+
+	// Pending offers, held in memory only: the color offering a draw or a
+	// rematch ("" when none), and the game a rematch created.
+	DrawOffer    string
+	RematchOffer string
+	RematchID    int64
+}
+
+// clone returns a copy that does not share the move slice with g.
+func (g *Game) clone() Game {
+	c := *g
+	c.Moves = slices.Clone(g.Moves)
+	return c
+}
+
+// PlayerFor returns the username seated as the given color ("black" or "white").
+func (g *Game) PlayerFor(color string) string {
+	switch color {
+	case "black":
+		return g.Black
+	case "white":
+		return g.White
+	}
+	return ""
+}
+
+// ColorOf returns the color a user is seated as, or "" if they are not playing.
+func (g *Game) ColorOf(username string) string {
+	switch {
+	case username == "":
+		return ""
+	case g.Black == username:
+		return "black"
+	case g.White == username:
+		return "white"
+	}
+	return ""
+}
+
+// over reports whether the game will accept no more moves.
+func (g *Game) over() bool {
+	return g.Status == GameFinished || g.Status == GameAborted
+}
+
+// Live games are kept in memory, keyed by ID. gamesMu guards both the map and
+// the Game values it points to; callers only ever receive copies. When a DB
+// is configured every game and move is also written to 442Game/442Move, and
+// the game ID is the table's auto-increment key; finished games are then
+// evicted from memory once saved (see evictLater) and read back on demand.
+// Without a DB the live store is the only copy, so nothing is evicted.
+var (
+	gamesMu    sync.RWMutex
+	games            = make(map[int64]*Game)
+	nextGameID int64 = 1
+)
+
+// finishedGameTTL is how long a finished or aborted game stays live after its
+// result is saved, so rematch offers (held in memory only) and players still
+// on the board page are served from memory.
+const finishedGameTTL = 10 * time.Minute
+
+// evictLater drops a game from the live store after finishedGameTTL, if it
+// is still over by then. The caller has saved the game to the DB.
+func evictLater(id int64) {
+	time.AfterFunc(finishedGameTTL, func() {
+		gamesMu.Lock()
+		defer gamesMu.Unlock()
+		if g, ok := games[id]; ok && g.over() {
+			delete(games, id)
+		}
+	})
+}
+
+// CreateGame stores a new game. The caller fills in the seats, starting
+// board and time control; ID, ToMove, Status and CreatedAt are set here.
+// The game is active when both seats are filled, otherwise it is waiting.
+func CreateGame(newGame Game) (Game, error) {
+	if newGame.Black == "" && newGame.White == "" {
+		return Game{}, fmt.Errorf("a game needs at least one player")
+	}
+	if newGame.Black != "" && newGame.Black == newGame.White {
+		return Game{}, fmt.Errorf("a player cannot take both seats")
+	}
+
+	g := &newGame
+	g.ToMove = "black"
+	g.Status = GameWaiting
+	g.Moves = nil
+	g.CreatedAt = time.Now()
+	if g.Black != "" && g.White != "" {
+		g.Status = GameActive
+	}
+
+	if DB != nil {
+		res, err := DB.Exec("INSERT INTO `442Game` (Black_Player, White_Player, Time_Control, Rated, Status, Created_At) VALUES (?, ?, ?, ?, ?, ?)",
+			g.Black, g.White, g.TimeControl, g.Rated, g.Status, g.CreatedAt)
+		if err != nil {
+			fmt.Printf("CreateGame: DB error: %v\n", err)
+			return Game{}, fmt.Errorf("database insert failed: %v", err)
+		}
+		if g.ID, err = res.LastInsertId(); err != nil {
+			return Game{}, err
+		}
+	}
+
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+	if DB == nil {
+		g.ID = nextGameID
+		nextGameID++
+	}
+	games[g.ID] = g
+	return g.clone(), nil
+}
+
+// ImportGame stores a finished game entered from a transcript, with its
+// moves, in one transaction. The caller has already replayed the moves and
+// filled in the board and result; only ID and Imported are set here.
+func ImportGame(ctx context.Context, newGame Game) (Game, error) {
+	g := &newGame
+	g.Imported = true
+	g.Rated = false
+
+	if DB != nil {
+		var finished sql.NullTime
+		if !g.FinishedAt.IsZero() {
+			finished = sql.NullTime{Time: g.FinishedAt, Valid: true}
+		}
+		tx, err := DB.BeginTx(ctx, nil)
+		if err != nil {
+			return Game{}, err
+		}
+		defer tx.Rollback()
+
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO `442Game` (Black_Player, White_Player, Time_Control, Rated, Imported, Status, Result, Result_Reason, Created_At, Finished_At) "+
+				"VALUES (?, ?, ?, 0, 1, ?, ?, ?, ?, ?)",
+			g.Black, g.White, g.TimeControl, g.Status, g.Result, g.ResultReason, g.CreatedAt, finished)
+		if err != nil {
+			fmt.Printf("ImportGame: DB error: %v\n", err)
+			return Game{}, fmt.Errorf("database insert failed: %v", err)
+		}
+		if g.ID, err = res.LastInsertId(); err != nil {
+			return Game{}, err
+		}
+		for _, m := range g.Moves {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO `442Move` (Game_ID, Ply, Color, Square, Played_At) VALUES (?, ?, ?, ?, ?)",
+				g.ID, m.Ply, m.Color, m.Square, m.PlayedAt); err != nil {
+				return Game{}, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return Game{}, err
+		}
+	}
+
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+	if DB == nil {
+		g.ID = nextGameID
+		nextGameID++
+	} else {
+		evictLater(g.ID)
+	}
+	games[g.ID] = g
+	return g.clone(), nil
+}
+
+// GetGame returns a copy of the live game with the given ID. Games that are
+// only in the database are not returned; use LoadGame for those.
+func GetGame(id int64) (Game, error) {
+	gamesMu.RLock()
+	defer gamesMu.RUnlock()
+	g, ok := games[id]
+	if !ok {
+		return Game{}, ErrGameNotFound
+	}
+	return g.clone(), nil
+}
+
+// ListActiveGames returns the games being played right now, newest first.
+// Only the live store is searched: a game in progress is always in memory.
+// Move lists are not included.
+func ListActiveGames() []Game {
+	gamesMu.RLock()
+	defer gamesMu.RUnlock()
+	var out []Game
+	for _, g := range games {
+		if g.Status == GameActive {
+			c := *g
+			c.Moves = nil
+			out = append(out, c)
+		}
+	}
+	slices.SortFunc(out, func(a, b Game) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return out
+}
+
+// ActiveTimedGameIDs returns the IDs of the timed games stored as active in
+// the DB, so their clocks can be resumed after a restart. Without a DB there
+// is nothing to resume and it returns nil.
+func ActiveTimedGameIDs(ctx context.Context) ([]int64, error) {
+	if DB == nil {
+		return nil, nil
+	}
+	rows, err := DB.QueryContext(ctx,
+		"SELECT Game_ID FROM `442Game` WHERE Status = ? AND Time_Control <> ''", GameActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CacheGame adds a game loaded from the database to the live store. If the
+// game is already live (another request loaded it first) the live copy wins
+// and is returned instead. A finished game is evicted again later.
+func CacheGame(g Game) Game {
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+	if live, ok := games[g.ID]; ok {
+		return live.clone()
+	}
+	stored := g.clone()
+	games[g.ID] = &stored
+	if stored.over() {
+		evictLater(stored.ID)
+	}
+	return stored.clone()
+}
+
+// UpdateGame runs fn on the stored game while holding the games lock, so a
+// read-validate-write sequence (e.g. playing a move) cannot interleave with
+// another update to the same game. If fn returns an error nothing is saved.
+func UpdateGame(id int64, fn func(g *Game) error) (Game, error) {
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+	g, ok := games[id]
+	if !ok {
+		return Game{}, ErrGameNotFound
+	}
+	updated := g.clone()
+	if err := fn(&updated); err != nil {
+		return g.clone(), err
+	}
+	*g = updated
+	return updated.clone(), nil
+}
+
+// SeatPlayer puts username into the open seat of a waiting game and makes it active.
+func SeatPlayer(id int64, username string) (Game, error) {
+	g, err := UpdateGame(id, func(g *Game) error {
+		if g.Status != GameWaiting {
+			return fmt.Errorf("game %d is not waiting for players", id)
+		}
+		if g.ColorOf(username) != "" {
+			return fmt.Errorf("%s is already seated in game %d", username, id)
+		}
+		switch {
+		case g.Black == "":
+			g.Black = username
+		case g.White == "":
+			g.White = username
+		}
+		g.Status = GameActive
+		return nil
+	})
+	if err != nil {
+		return g, err
+	}
+	if err := SaveGame(context.Background(), g); err != nil {
+		fmt.Printf("SeatPlayer: DB error for game %d: %v\n", id, err)
+	}
+	return g, nil
+}
+
+// GetTurn returns the username whose turn it is in the given game.
+func GetTurn(id int64) (string, error) {
+	g, err := GetGame(id)
+	if err != nil {
+		return "", err
+	}
+	return g.PlayerFor(g.ToMove), nil
+}
+
+// InsertMove records one ply of a game. It is a no-op without a DB, since the
+// live store already holds the move list.
+func InsertMove(ctx context.Context, gameID int64, m Move) error {
+	if DB == nil {
+		return nil
+	}
+	var clock sql.NullInt64
+	if m.Clock > 0 {
+		clock = sql.NullInt64{Int64: m.Clock.Milliseconds(), Valid: true}
+	}
+	_, err := DB.ExecContext(ctx,
+		"INSERT INTO `442Move` (Game_ID, Ply, Color, Square, Played_At, Clock_Ms) VALUES (?, ?, ?, ?, ?, ?)",
+		gameID, m.Ply, m.Color, m.Square, m.PlayedAt, clock)
+	return err
+}
+
+// SaveGame writes a game's seats, status, result (and its reason) and finish
+// time to the DB. Once a finished or aborted game is saved it is evicted from
+// the live store after finishedGameTTL.
+// It is a no-op without a DB.
+func SaveGame(ctx context.Context, g Game) error {
+	if DB == nil {
+		return nil
+	}
+	var finished sql.NullTime
+	if !g.FinishedAt.IsZero() {
+		finished = sql.NullTime{Time: g.FinishedAt, Valid: true}
+	}
+	_, err := DB.ExecContext(ctx,
+		"UPDATE `442Game` SET Black_Player = ?, White_Player = ?, Status = ?, Result = ?, Result_Reason = ?, Finished_At = ? WHERE Game_ID = ?",
+		g.Black, g.White, g.Status, g.Result, g.ResultReason, finished, g.ID)
+	if err != nil {
+		return err
+	}
+	if g.over() {
+		evictLater(g.ID)
+	}
+	return nil
+}
+
+// gameColumns are the 442Game columns read by scanGame, in order.
+const gameColumns = "Game_ID, Black_Player, White_Player, Time_Control, Rated, Imported, Status, Result, Result_Reason, Created_At, Finished_At"
+
+// scanGame reads one row selected with gameColumns.
+func scanGame(row interface{ Scan(...any) error }) (Game, error) {
+	var g Game
+	var finished sql.NullTime
+	if err := row.Scan(&g.ID, &g.Black, &g.White, &g.TimeControl, &g.Rated, &g.Imported, &g.Status, &g.Result, &g.ResultReason, &g.CreatedAt, &finished); err != nil {
+		return Game{}, err
+	}
+	if finished.Valid {
+		g.FinishedAt = finished.Time
+	}
+	return g, nil
+}
+
+// LoadGame reads a game and its full move list from the DB. The returned
+// game has no Board, ToMove or clocks: the caller rebuilds those by
+// replaying Moves.
+func LoadGame(ctx context.Context, id int64) (Game, error) {
+	if DB == nil {
+		return Game{}, ErrGameNotFound
+	}
+	g, err := scanGame(DB.QueryRowContext(ctx, "SELECT "+gameColumns+" FROM `442Game` WHERE Game_ID = ?", id))
+	if err == sql.ErrNoRows {
+		return Game{}, ErrGameNotFound
+	} else if err != nil {
+		return Game{}, err
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT Ply, Color, Square, Played_At, Clock_Ms FROM `442Move` WHERE Game_ID = ? ORDER BY Ply", id)
+	if err != nil {
+		return Game{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Move
+		var clock sql.NullInt64
+		if err := rows.Scan(&m.Ply, &m.Color, &m.Square, &m.PlayedAt, &clock); err != nil {
+			return Game{}, err
+		}
+		m.Clock = time.Duration(clock.Int64) * time.Millisecond
+		g.Moves = append(g.Moves, m)
+	}
+	if err := rows.Err(); err != nil {
+		return Game{}, err
+	}
+	return g, nil
 }
 
-// Update the database to advance to the next player's turn
-func NextTurn() string {
-	currentIndex = (currentIndex + 1) % len(players)
-	return players[currentIndex]
+// ListUserGames returns the games a user has played in, newest first.
+// Move lists are not included, nor are imported games, whose player names
+// need not belong to accounts here. Without a DB the live store is searched.
+func ListUserGames(ctx context.Context, username string, limit int) ([]Game, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	if DB == nil {
+		gamesMu.RLock()
+		defer gamesMu.RUnlock()
+		var out []Game
+		for _, g := range games {
+			if g.ColorOf(username) != "" && !g.Imported {
+				c := *g
+				c.Moves = nil
+				out = append(out, c)
+			}
+		}
+		slices.SortFunc(out, func(a, b Game) int { return b.CreatedAt.Compare(a.CreatedAt) })
+		if len(out) > limit {
+			out = out[:limit]
+		}
+		return out, nil
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT "+gameColumns+" FROM `442Game` WHERE Black_Player = ? AND Imported = 0 "+
+			"UNION ALL SELECT "+gameColumns+" FROM `442Game` WHERE White_Player = ? AND Imported = 0 "+
+			"ORDER BY Created_At DESC LIMIT ?", username, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Game
+	for rows.Next() {
+		g, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
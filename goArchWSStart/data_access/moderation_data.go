@@ -0,0 +1,383 @@
+package data_access
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of ChatSanction.
+const (
+	SanctionMute = "mute"
+	SanctionBan  = "ban"
+)
+
+// ChatSanction is a mute or ban keeping a user from posting in chat.
+type ChatSanction struct {
+	ID        int64
+	Username  string
+	Kind      string // SanctionMute or SanctionBan
+	Reason    string
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero if it lasts until lifted
+	LiftedAt  time.Time // zero unless a moderator lifted it
+}
+
+// activeAt reports whether the sanction applies at t.
+func (s *ChatSanction) activeAt(t time.Time) bool {
+	return s.LiftedAt.IsZero() && (s.ExpiresAt.IsZero() || s.ExpiresAt.After(t))
+}
+
+// ChatReport is a chat message reported to the moderators. Message is the
+// text when it was reported, so it survives the message being edited or
+// deleted.
+type ChatReport struct {
+	ID           int64
+	MessageID    int64
+	Room         string
+	Reporter     string
+	ReportedUser string
+	Message      string
+	Reason       string
+	CreatedAt    time.Time
+	ResolvedAt   time.Time // zero while open
+	ResolvedBy   string
+}
+
+// ModerationEntry is one line of the moderation audit log.
+type ModerationEntry struct {
+	ID        int64
+	Actor     string // the moderator, or the reporter of a report
+	Action    string // e.g. "mute", "ban", "delete", "clear", "report"
+	Target    string // the user acted on
+	MessageID int64  // 0 unless the action concerned one message
+	Detail    string
+	CreatedAt time.Time
+}
+
+// ErrReportNotFound is returned when no report has the given ID.
+var ErrReportNotFound = errors.New("report not found")
+
+// In-memory fallback used when no DB is configured.
+var (
+	moderationMu    sync.RWMutex
+	inMemModerators = make(map[string]bool)
+	inMemSanctions  []ChatSanction    // in ID order
+	inMemReports    []ChatReport      // in ID order
+	inMemModLog     []ModerationEntry // in ID order
+)
+
+// nullTime is t for a nullable column: NULL if t is zero.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// IsModerator reports whether a user may moderate chat.
+func IsModerator(ctx context.Context, username string) (bool, error) {
+	if DB == nil {
+		moderationMu.RLock()
+		defer moderationMu.RUnlock()
+		return inMemModerators[username], nil
+	}
+
+	var mod bool
+	err := DB.QueryRowContext(ctx, "SELECT Is_Moderator FROM `442Account` WHERE Username = ?", username).Scan(&mod)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return mod, err
+}
+
+// SetModerator grants or revokes a user's moderator role.
+func SetModerator(ctx context.Context, username string, moderator bool) error {
+	if DB == nil {
+		moderationMu.Lock()
+		defer moderationMu.Unlock()
+		if moderator {
+			inMemModerators[username] = true
+		} else {
+			delete(inMemModerators, username)
+		}
+		return nil
+	}
+
+	_, err := DB.ExecContext(ctx, "UPDATE `442Account` SET Is_Moderator = ? WHERE Username = ?", moderator, username)
+	return err
+}
+
+// InsertSanction stores a mute or ban; ID and CreatedAt are set here.
+func InsertSanction(ctx context.Context, s ChatSanction) (ChatSanction, error) {
+	s.CreatedAt = time.Now().Truncate(time.Second)
+	s.LiftedAt = time.Time{}
+
+	if DB == nil {
+		moderationMu.Lock()
+		defer moderationMu.Unlock()
+		s.ID = int64(len(inMemSanctions) + 1)
+		inMemSanctions = append(inMemSanctions, s)
+		return s, nil
+	}
+
+	res, err := DB.ExecContext(ctx,
+		"INSERT INTO `442Chat_Sanction` (Username, Kind, Reason, Created_By, Created_At, Expires_At) VALUES (?, ?, ?, ?, ?, ?)",
+		s.Username, s.Kind, s.Reason, s.CreatedBy, s.CreatedAt, nullTime(s.ExpiresAt))
+	if err != nil {
+		return ChatSanction{}, err
+	}
+	if s.ID, err = res.LastInsertId(); err != nil {
+		return ChatSanction{}, err
+	}
+	return s, nil
+}
+
+// ActiveSanctions returns the mutes and bans that apply to a user at now,
+// newest first.
+func ActiveSanctions(ctx context.Context, username string, now time.Time) ([]ChatSanction, error) {
+	if DB == nil {
+		moderationMu.RLock()
+		defer moderationMu.RUnlock()
+		var out []ChatSanction
+		for i := len(inMemSanctions) - 1; i >= 0; i-- {
+			if s := inMemSanctions[i]; s.Username == username && s.activeAt(now) {
+				out = append(out, s)
+			}
+		}
+		return out, nil
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT Sanction_ID, Username, Kind, Reason, Created_By, Created_At, Expires_At FROM `442Chat_Sanction` "+
+			"WHERE Username = ? AND Lifted_At IS NULL AND (Expires_At IS NULL OR Expires_At > ?) "+
+			"ORDER BY Sanction_ID DESC", username, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ChatSanction
+	for rows.Next() {
+		var s ChatSanction
+		var expires sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Username, &s.Kind, &s.Reason, &s.CreatedBy, &s.CreatedAt, &expires); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			s.ExpiresAt = expires.Time
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// LiftSanctions ends a user's active sanctions of one kind and returns how
+// many there were.
+func LiftSanctions(ctx context.Context, username, kind string, now time.Time) (int64, error) {
+	if DB == nil {
+		moderationMu.Lock()
+		defer moderationMu.Unlock()
+		var n int64
+		for i := range inMemSanctions {
+			if s := &inMemSanctions[i]; s.Username == username && s.Kind == kind && s.activeAt(now) {
+				s.LiftedAt = now
+				n++
+			}
+		}
+		return n, nil
+	}
+
+	res, err := DB.ExecContext(ctx,
+		"UPDATE `442Chat_Sanction` SET Lifted_At = ? "+
+			"WHERE Username = ? AND Kind = ? AND Lifted_At IS NULL AND (Expires_At IS NULL OR Expires_At > ?)",
+		now, username, kind, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// InsertReport stores a report; ID and CreatedAt are set here.
+func InsertReport(ctx context.Context, r ChatReport) (ChatReport, error) {
+	r.CreatedAt = time.Now().Truncate(time.Second)
+	r.ResolvedAt, r.ResolvedBy = time.Time{}, ""
+
+	if DB == nil {
+		moderationMu.Lock()
+		defer moderationMu.Unlock()
+		r.ID = int64(len(inMemReports) + 1)
+		inMemReports = append(inMemReports, r)
+		return r, nil
+	}
+
+	res, err := DB.ExecContext(ctx,
+		"INSERT INTO `442Chat_Report` (Message_ID, Room_ID, Reporter, Reported_User, Message, Reason, Created_At) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		r.MessageID, r.Room, r.Reporter, r.ReportedUser, r.Message, r.Reason, r.CreatedAt)
+	if err != nil {
+		return ChatReport{}, err
+	}
+	if r.ID, err = res.LastInsertId(); err != nil {
+		return ChatReport{}, err
+	}
+	return r, nil
+}
+
+// reportColumns are the 442Chat_Report columns read by scanReport, in order.
+const reportColumns = "Report_ID, Message_ID, Room_ID, Reporter, Reported_User, Message, Reason, Created_At, Resolved_At, Resolved_By"
+
+// scanReport reads one row selected with reportColumns.
+func scanReport(row interface{ Scan(...any) error }) (ChatReport, error) {
+	var r ChatReport
+	var resolved sql.NullTime
+	if err := row.Scan(&r.ID, &r.MessageID, &r.Room, &r.Reporter, &r.ReportedUser, &r.Message, &r.Reason, &r.CreatedAt, &resolved, &r.ResolvedBy); err != nil {
+		return ChatReport{}, err
+	}
+	if resolved.Valid {
+		r.ResolvedAt = resolved.Time
+	}
+	return r, nil
+}
+
+// ListReports returns up to limit reports, newest first; only the open ones
+// if openOnly is set.
+func ListReports(ctx context.Context, openOnly bool, limit int) ([]ChatReport, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	if DB == nil {
+		moderationMu.RLock()
+		defer moderationMu.RUnlock()
+		var out []ChatReport
+		for i := len(inMemReports) - 1; i >= 0 && len(out) < limit; i-- {
+			if r := inMemReports[i]; !openOnly || r.ResolvedAt.IsZero() {
+				out = append(out, r)
+			}
+		}
+		return out, nil
+	}
+
+	query := "SELECT " + reportColumns + " FROM `442Chat_Report` "
+	if openOnly {
+		query += "WHERE Resolved_At IS NULL "
+	}
+	rows, err := DB.QueryContext(ctx, query+"ORDER BY Report_ID DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ChatReport
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// ResolveReport closes a report and returns it.
+func ResolveReport(ctx context.Context, id int64, by string) (ChatReport, error) {
+	now := time.Now().Truncate(time.Second)
+	if DB == nil {
+		moderationMu.Lock()
+		defer moderationMu.Unlock()
+		i := slices.IndexFunc(inMemReports, func(r ChatReport) bool { return r.ID == id })
+		if i < 0 {
+			return ChatReport{}, ErrReportNotFound
+		}
+		if inMemReports[i].ResolvedAt.IsZero() {
+			inMemReports[i].ResolvedAt, inMemReports[i].ResolvedBy = now, by
+		}
+		return inMemReports[i], nil
+	}
+
+	if _, err := DB.ExecContext(ctx,
+		"UPDATE `442Chat_Report` SET Resolved_At = ?, Resolved_By = ? WHERE Report_ID = ? AND Resolved_At IS NULL",
+		now, by, id); err != nil {
+		return ChatReport{}, err
+	}
+	r, err := scanReport(DB.QueryRowContext(ctx, "SELECT "+reportColumns+" FROM `442Chat_Report` WHERE Report_ID = ?", id))
+	if err == sql.ErrNoRows {
+		return ChatReport{}, ErrReportNotFound
+	}
+	return r, err
+}
+
+// InsertModerationEntry appends to the moderation audit log; ID and
+// CreatedAt are set here.
+func InsertModerationEntry(ctx context.Context, e ModerationEntry) (ModerationEntry, error) {
+	e.CreatedAt = time.Now().Truncate(time.Second)
+
+	if DB == nil {
+		moderationMu.Lock()
+		defer moderationMu.Unlock()
+		e.ID = int64(len(inMemModLog) + 1)
+		inMemModLog = append(inMemModLog, e)
+		return e, nil
+	}
+
+	messageID := sql.NullInt64{Int64: e.MessageID, Valid: e.MessageID != 0}
+	res, err := DB.ExecContext(ctx,
+		"INSERT INTO `442Moderation_Log` (Actor, Action, Target_User, Message_ID, Detail, Created_At) VALUES (?, ?, ?, ?, ?, ?)",
+		e.Actor, e.Action, e.Target, messageID, e.Detail, e.CreatedAt)
+	if err != nil {
+		return ModerationEntry{}, err
+	}
+	if e.ID, err = res.LastInsertId(); err != nil {
+		return ModerationEntry{}, err
+	}
+	return e, nil
+}
+
+// ListModerationLog returns one page of the audit log, newest first: up to
+// limit entries with an ID below beforeID (0 for the newest), only those
+// about target if it is set.
+func ListModerationLog(ctx context.Context, target string, beforeID int64, limit int) ([]ModerationEntry, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if beforeID <= 0 {
+		beforeID = 1<<63 - 1
+	}
+
+	if DB == nil {
+		moderationMu.RLock()
+		defer moderationMu.RUnlock()
+		var out []ModerationEntry
+		for i := len(inMemModLog) - 1; i >= 0 && len(out) < limit; i-- {
+			if e := inMemModLog[i]; e.ID < beforeID && (target == "" || e.Target == target) {
+				out = append(out, e)
+			}
+		}
+		return out, nil
+	}
+
+	query := "SELECT Log_ID, Actor, Action, Target_User, Message_ID, Detail, Created_At FROM `442Moderation_Log` WHERE Log_ID < ? "
+	args := []any{beforeID}
+	if target != "" {
+		query += "AND Target_User = ? "
+		args = append(args, target)
+	}
+	rows, err := DB.QueryContext(ctx, query+"ORDER BY Log_ID DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ModerationEntry
+	for rows.Next() {
+		var e ModerationEntry
+		var messageID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &messageID, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.MessageID = messageID.Int64
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
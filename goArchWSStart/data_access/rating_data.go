@@ -0,0 +1,327 @@
+package data_access
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlayerRating is a row in the rating table: one player's Glicko-2 rating
+// in one time-control category.
+type PlayerRating struct {
+	Username    string
+	Category    string
+	Rating      float64
+	RD          float64 // rating deviation
+	Volatility  float64
+	GamesPlayed int
+	Wins        int
+	Losses      int
+	Draws       int
+	UpdatedAt   time.Time
+}
+
+// RatingHistoryEntry records a player's rating after one rated game.
+type RatingHistoryEntry struct {
+	Username   string
+	Category   string
+	GameID     int64
+	Rating     float64
+	RD         float64
+	Change     float64
+	RecordedAt time.Time
+}
+
+// ratingKey identifies an in-memory rating row.
+type ratingKey struct{ username, category string }
+
+// In-memory fallback used when no DB is configured.
+var (
+	ratingsMu      sync.RWMutex
+	inMemRatings   = make(map[ratingKey]PlayerRating)
+	inMemRatingLog []RatingHistoryEntry
+)
+
+const ratingColumns = "Username, Category, Rating, RD, Volatility, Games_Played, Wins, Losses, Draws, Updated_At"
+
+func scanRating(row interface{ Scan(...any) error }) (PlayerRating, error) {
+	var r PlayerRating
+	err := row.Scan(&r.Username, &r.Category, &r.Rating, &r.RD, &r.Volatility,
+		&r.GamesPlayed, &r.Wins, &r.Losses, &r.Draws, &r.UpdatedAt)
+	return r, err
+}
+
+// GetRating returns a player's rating in a category. ok is false if the
+// player has never played a rated game in that category.
+func GetRating(ctx context.Context, username, category string) (PlayerRating, bool, error) {
+	if DB == nil {
+		ratingsMu.RLock()
+		defer ratingsMu.RUnlock()
+		r, ok := inMemRatings[ratingKey{username, category}]
+		return r, ok, nil
+	}
+
+	r, err := scanRating(DB.QueryRowContext(ctx,
+		"SELECT "+ratingColumns+" FROM `442Rating` WHERE Username = ? AND Category = ?", username, category))
+	if err == sql.ErrNoRows {
+		return PlayerRating{}, false, nil
+	} else if err != nil {
+		return PlayerRating{}, false, err
+	}
+	return r, true, nil
+}
+
+// GetRatings returns every category a player has a rating in.
+func GetRatings(ctx context.Context, username string) ([]PlayerRating, error) {
+	if DB == nil {
+		ratingsMu.RLock()
+		defer ratingsMu.RUnlock()
+		var out []PlayerRating
+		for k, r := range inMemRatings {
+			if k.username == username {
+				out = append(out, r)
+			}
+		}
+		slices.SortFunc(out, func(a, b PlayerRating) int { return b.GamesPlayed - a.GamesPlayed })
+		return out, nil
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT "+ratingColumns+" FROM `442Rating` WHERE Username = ? ORDER BY Games_Played DESC", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PlayerRating
+	for rows.Next() {
+		r, err := scanRating(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SaveGameRatings rates one game: it reads the current rating rows of the
+// game's players, passes them to rate, and stores the ratings rate returns
+// along with their history rows (changes[i] is ratings[i]'s rating change).
+// It all happens in one transaction with the players' rows locked, so two
+// games finishing at once for the same player are rated one after the
+// other, and a game is never half-rated. fresh holds the row to start from
+// for each player, used when they have no rating in its category yet.
+func SaveGameRatings(ctx context.Context, gameID int64, fresh []PlayerRating, rate func(current []PlayerRating) (ratings []PlayerRating, changes []float64)) error {
+	now := time.Now()
+
+	if DB == nil {
+		ratingsMu.Lock()
+		defer ratingsMu.Unlock()
+		current := slices.Clone(fresh)
+		for i, r := range fresh {
+			if stored, ok := inMemRatings[ratingKey{r.Username, r.Category}]; ok {
+				current[i] = stored
+			}
+		}
+		ratings, changes := rate(current)
+		for i, r := range ratings {
+			r.UpdatedAt = now
+			inMemRatings[ratingKey{r.Username, r.Category}] = r
+			inMemRatingLog = append(inMemRatingLog, RatingHistoryEntry{
+				Username: r.Username, Category: r.Category, GameID: gameID,
+				Rating: r.Rating, RD: r.RD, Change: changes[i], RecordedAt: now,
+			})
+		}
+		return nil
+	}
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Create missing rows first, so the locking reads below lock rows rather
+	// than gaps, and lock in username order so two games cannot deadlock.
+	order := make([]int, len(fresh))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return strings.Compare(fresh[a].Username, fresh[b].Username) })
+	current := make([]PlayerRating, len(fresh))
+	for _, i := range order {
+		r := fresh[i]
+		if _, err := tx.ExecContext(ctx,
+			"INSERT IGNORE INTO `442Rating` ("+ratingColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			r.Username, r.Category, r.Rating, r.RD, r.Volatility, r.GamesPlayed, r.Wins, r.Losses, r.Draws, now); err != nil {
+			return err
+		}
+		if current[i], err = scanRating(tx.QueryRowContext(ctx,
+			"SELECT "+ratingColumns+" FROM `442Rating` WHERE Username = ? AND Category = ? FOR UPDATE",
+			r.Username, r.Category)); err != nil {
+			return err
+		}
+	}
+
+	ratings, changes := rate(current)
+	for i, r := range ratings {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE `442Rating` SET Rating = ?, RD = ?, Volatility = ?, Games_Played = ?, Wins = ?, Losses = ?, Draws = ?, Updated_At = ? "+
+				"WHERE Username = ? AND Category = ?",
+			r.Rating, r.RD, r.Volatility, r.GamesPlayed, r.Wins, r.Losses, r.Draws, now, r.Username, r.Category)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO `442Rating_History` (Username, Category, Game_ID, Rating, RD, Rating_Change, Recorded_At) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			r.Username, r.Category, gameID, r.Rating, r.RD, changes[i], now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRatingHistory returns a player's rating after each rated game in a
+// category, oldest first, limited to the most recent `limit` games.
+func GetRatingHistory(ctx context.Context, username, category string, limit int) ([]RatingHistoryEntry, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	if DB == nil {
+		ratingsMu.RLock()
+		defer ratingsMu.RUnlock()
+		var out []RatingHistoryEntry
+		for _, h := range inMemRatingLog {
+			if h.Username == username && h.Category == category {
+				out = append(out, h)
+			}
+		}
+		if len(out) > limit {
+			out = out[len(out)-limit:]
+		}
+		return out, nil
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT Username, Category, Game_ID, Rating, RD, Rating_Change, Recorded_At FROM ("+
+			"SELECT * FROM `442Rating_History` WHERE Username = ? AND Category = ? "+
+			"ORDER BY Recorded_At DESC, History_ID DESC LIMIT ?) recent "+
+			"ORDER BY Recorded_At, History_ID", username, category, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RatingHistoryEntry
+	for rows.Next() {
+		var h RatingHistoryEntry
+		if err := rows.Scan(&h.Username, &h.Category, &h.GameID, &h.Rating, &h.RD, &h.Change, &h.RecordedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetGameRatings returns the rating history rows written for one rated game,
+// keyed by username. Rating minus Change is the rating the player took into
+// the game.
+func GetGameRatings(ctx context.Context, gameID int64) (map[string]RatingHistoryEntry, error) {
+	out := make(map[string]RatingHistoryEntry)
+	if DB == nil {
+		ratingsMu.RLock()
+		defer ratingsMu.RUnlock()
+		for _, h := range inMemRatingLog {
+			if h.GameID == gameID {
+				out[h.Username] = h
+			}
+		}
+		return out, nil
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT Username, Category, Game_ID, Rating, RD, Rating_Change, Recorded_At FROM `442Rating_History` WHERE Game_ID = ?", gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h RatingHistoryEntry
+		if err := rows.Scan(&h.Username, &h.Category, &h.GameID, &h.Rating, &h.RD, &h.Change, &h.RecordedAt); err != nil {
+			return nil, err
+		}
+		out[h.Username] = h
+	}
+	return out, rows.Err()
+}
+
+// Leaderboard returns one page of the players in a category with at least
+// minGames rated games, best rating first, plus the total number of such
+// players for pagination. The ordering matches idx_leaderboard, so only the
+// requested page is read.
+func Leaderboard(ctx context.Context, category string, minGames, limit, offset int) ([]PlayerRating, int, error) {
+	if DB == nil {
+		ratingsMu.RLock()
+		defer ratingsMu.RUnlock()
+		var all []PlayerRating
+		for _, r := range inMemRatings {
+			if r.Category == category && r.GamesPlayed >= minGames {
+				all = append(all, r)
+			}
+		}
+		slices.SortFunc(all, func(a, b PlayerRating) int {
+			if a.Rating != b.Rating {
+				if a.Rating > b.Rating {
+					return -1
+				}
+				return 1
+			}
+			return b.Wins - a.Wins
+		})
+		total := len(all)
+		if offset >= total {
+			return nil, total, nil
+		}
+		return all[offset:min(offset+limit, total)], total, nil
+	}
+
+	var total int
+	if err := DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM `442Rating` WHERE Category = ? AND Games_Played >= ?",
+		category, minGames).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT "+ratingColumns+" FROM `442Rating` WHERE Category = ? AND Games_Played >= ? "+
+			"ORDER BY Rating DESC, Wins DESC LIMIT ? OFFSET ?",
+		category, minGames, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var out []PlayerRating
+	for rows.Next() {
+		r, err := scanRating(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
@@ -0,0 +1,161 @@
+package data_access
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order, once each. The number of applied
+// migrations is recorded in 442Schema_Version, so to change the schema
+// append a new statement here; never edit one that has already shipped.
+// The 442Account and 442Chat tables predate this list and are created by hand.
+var migrations = []string{
+	// 1: games
+	"CREATE TABLE IF NOT EXISTS `442Game` (" +
+		"Game_ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY," +
+		"Black_Player VARCHAR(50) NOT NULL DEFAULT ''," +
+		"White_Player VARCHAR(50) NOT NULL DEFAULT ''," +
+		"Status VARCHAR(16) NOT NULL DEFAULT 'waiting'," +
+		"Created_At DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"Finished_At DATETIME NULL," +
+		"INDEX idx_game_black (Black_Player, Created_At)," +
+		"INDEX idx_game_white (White_Player, Created_At)" +
+		")",
+	// 2: move history, one row per ply
+	"CREATE TABLE IF NOT EXISTS `442Move` (" +
+		"Game_ID BIGINT NOT NULL," +
+		"Ply INT NOT NULL," +
+		"Color VARCHAR(5) NOT NULL," +
+		"Square CHAR(2) NOT NULL," +
+		"Played_At DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)," +
+		"PRIMARY KEY (Game_ID, Ply)," +
+		"FOREIGN KEY (Game_ID) REFERENCES `442Game` (Game_ID) ON DELETE CASCADE" +
+		")",
+	// 3: time control, e.g. "5+3"; empty for untimed games
+	"ALTER TABLE `442Game` ADD COLUMN Time_Control VARCHAR(16) NOT NULL DEFAULT '' AFTER White_Player",
+	// 4: rated flag and result ("black", "white", "draw"; empty while playing)
+	"ALTER TABLE `442Game` ADD COLUMN Rated TINYINT(1) NOT NULL DEFAULT 0 AFTER Time_Control, " +
+		"ADD COLUMN Result VARCHAR(8) NOT NULL DEFAULT '' AFTER Status",
+	// 5: current Glicko-2 rating per player and time-control category
+	"CREATE TABLE IF NOT EXISTS `442Rating` (" +
+		"Username VARCHAR(50) NOT NULL," +
+		"Category VARCHAR(16) NOT NULL," +
+		"Rating DOUBLE NOT NULL," +
+		"RD DOUBLE NOT NULL," +
+		"Volatility DOUBLE NOT NULL," +
+		"Games_Played INT NOT NULL DEFAULT 0," +
+		"Wins INT NOT NULL DEFAULT 0," +
+		"Losses INT NOT NULL DEFAULT 0," +
+		"Draws INT NOT NULL DEFAULT 0," +
+		"Updated_At DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"PRIMARY KEY (Username, Category)," +
+		"INDEX idx_rating_category (Category, Rating)" +
+		")",
+	// 6: rating after every rated game, for progress charts
+	"CREATE TABLE IF NOT EXISTS `442Rating_History` (" +
+		"History_ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY," +
+		"Username VARCHAR(50) NOT NULL," +
+		"Category VARCHAR(16) NOT NULL," +
+		"Game_ID BIGINT NOT NULL," +
+		"Rating DOUBLE NOT NULL," +
+		"RD DOUBLE NOT NULL," +
+		"Rating_Change DOUBLE NOT NULL," +
+		"Recorded_At DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"INDEX idx_history_user (Username, Category, Recorded_At)" +
+		")",
+	// 7: leaderboard index, so ranking by rating then wins is read in index order
+	"ALTER TABLE `442Rating` DROP INDEX idx_rating_category, ADD INDEX idx_leaderboard (Category, Rating, Wins)",
+	// 8: mover's remaining clock after each move of a timed game
+	"ALTER TABLE `442Move` ADD COLUMN Clock_Ms BIGINT NULL AFTER Played_At",
+	// 9: how a game ended ("score", "resignation", "timeout", "agreement", "abort")
+	"ALTER TABLE `442Game` ADD COLUMN Result_Reason VARCHAR(16) NOT NULL DEFAULT '' AFTER Result",
+	// 10: games entered from transcripts, kept out of players' game lists
+	"ALTER TABLE `442Game` ADD COLUMN Imported TINYINT(1) NOT NULL DEFAULT 0 AFTER Rated",
+	// 11: chat rooms; existing messages belong to the lobby, game rooms are "game:<id>"
+	"ALTER TABLE `442Chat` ADD COLUMN room_id VARCHAR(32) NOT NULL DEFAULT 'lobby', " +
+		"ADD INDEX idx_chat_room (room_id, chat_date)",
+	// 12: private messages between two users; Read_At stays NULL until read
+	"CREATE TABLE IF NOT EXISTS `442Direct_Message` (" +
+		"Message_ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY," +
+		"Sender VARCHAR(50) NOT NULL," +
+		"Recipient VARCHAR(50) NOT NULL," +
+		"Body VARCHAR(2000) NOT NULL," +
+		"Sent_At DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3)," +
+		"Read_At DATETIME(3) NULL," +
+		"INDEX idx_dm_pair (Sender, Recipient, Message_ID)," +
+		"INDEX idx_dm_unread (Recipient, Read_At)" +
+		")",
+	// 13: stable chat message IDs, so messages can be edited and deleted;
+	// edited_at stays NULL until a message is edited
+	"ALTER TABLE `442Chat` ADD COLUMN message_id BIGINT NOT NULL AUTO_INCREMENT UNIQUE FIRST, " +
+		"ADD COLUMN edited_at DATETIME NULL",
+	// 14: chat moderators
+	"ALTER TABLE `442Account` ADD COLUMN Is_Moderator TINYINT(1) NOT NULL DEFAULT 0",
+	// 15: chat mutes and bans; Expires_At NULL lasts until lifted
+	"CREATE TABLE IF NOT EXISTS `442Chat_Sanction` (" +
+		"Sanction_ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY," +
+		"Username VARCHAR(50) NOT NULL," +
+		"Kind VARCHAR(8) NOT NULL," +
+		"Reason VARCHAR(500) NOT NULL DEFAULT ''," +
+		"Created_By VARCHAR(50) NOT NULL," +
+		"Created_At DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"Expires_At DATETIME NULL," +
+		"Lifted_At DATETIME NULL," +
+		"INDEX idx_sanction_user (Username, Lifted_At)" +
+		")",
+	// 16: chat messages reported by users, with a copy of the text at the time
+	"CREATE TABLE IF NOT EXISTS `442Chat_Report` (" +
+		"Report_ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY," +
+		"Message_ID BIGINT NOT NULL," +
+		"Room_ID VARCHAR(32) NOT NULL," +
+		"Reporter VARCHAR(50) NOT NULL," +
+		"Reported_User VARCHAR(50) NOT NULL," +
+		"Message TEXT NOT NULL," +
+		"Reason VARCHAR(500) NOT NULL DEFAULT ''," +
+		"Created_At DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"Resolved_At DATETIME NULL," +
+		"Resolved_By VARCHAR(50) NOT NULL DEFAULT ''," +
+		"INDEX idx_report_open (Resolved_At, Report_ID)" +
+		")",
+	// 17: audit log of moderation actions and reports
+	"CREATE TABLE IF NOT EXISTS `442Moderation_Log` (" +
+		"Log_ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY," +
+		"Actor VARCHAR(50) NOT NULL," +
+		"Action VARCHAR(16) NOT NULL," +
+		"Target_User VARCHAR(50) NOT NULL DEFAULT ''," +
+		"Message_ID BIGINT NULL," +
+		"Detail TEXT NOT NULL," +
+		"Created_At DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"INDEX idx_log_target (Target_User, Log_ID)" +
+		")",
+	// 18: chat history is paged by message ID within a room, not by date
+	"ALTER TABLE `442Chat` DROP INDEX idx_chat_room, ADD INDEX idx_chat_room_id (room_id, message_id)",
+}
+
+// Migrate brings the database schema up to date. It is safe to call on every
+// start-up; already-applied migrations are skipped.
+func Migrate(ctx context.Context) error {
+	if DB == nil {
+		return sql.ErrConnDone
+	}
+	if _, err := DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `442Schema_Version` (Version INT NOT NULL)"); err != nil {
+		return err
+	}
+
+	var version int
+	if err := DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(Version), 0) FROM `442Schema_Version`").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if _, err := DB.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := DB.ExecContext(ctx, "INSERT INTO `442Schema_Version` (Version) VALUES (?)", i+1); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		fmt.Printf("Migrate: applied migration %d\n", i+1)
+	}
+	return nil
+}
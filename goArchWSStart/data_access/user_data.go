@@ -65,20 +65,28 @@ func GetUser(username string) (string, bool) {
 }
 
 // GetOnlineUsers returns a list of User structs that currently have a session token set.
+// A token only means the user logged in at some point and has not logged out;
+// live presence is tracked from open WebSocket connections by the service layer.
 func GetOnlineUsers() ([]User, error) {
 	if DB == nil {
 		return nil, sql.ErrConnDone
 	}
 
-	row := DB.QueryRow("SELECT Username FROM `442Account` WHERE Account_Token IS NOT NULL")
+	rows, err := DB.Query("SELECT Account_Token, Username FROM `442Account` WHERE Account_Token IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	var out []User
-	var m User
-	if err := row.Scan(&m.Account_Token, &m.Username); err != nil {
-		return nil, err
+	for rows.Next() {
+		var m User
+		if err := rows.Scan(&m.Account_Token, &m.Username); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
 	}
-	out = append(out, m)
-	if err := row.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 	return out, nil
@@ -87,13 +95,14 @@ func GetOnlineUsers() ([]User, error) {
 // OnlineUsers returns a list of usernames that currently have a session token set.
 func OnlineUsers() ([]string, error) {
 	if DB != nil {
-		var users []string
-		row := DB.QueryRow("SELECT Username FROM `442Account` WHERE Account_Token IS NOT NULL")
-		if err := row.Scan(&users); err == nil {
-			return users, nil
-		} else if err != sql.ErrNoRows {
-			// If some DB error occurred, fall back to in-memory
+		if users, err := GetOnlineUsers(); err == nil {
+			names := make([]string, 0, len(users))
+			for _, u := range users {
+				names = append(names, u.Username)
+			}
+			return names, nil
 		}
+		// If some DB error occurred, fall back to in-memory
 	}
 
 	usersMu.RLock()
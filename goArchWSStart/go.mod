@@ -6,9 +6,8 @@ require (
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/crypto v0.46.0
+	golang.org/x/text v0.32.0
 )
 
-require (
-	filippo.io/edwards25519 v1.1.0 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
-)
+require filippo.io/edwards25519 v1.1.0 // indirect
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"othello/business_logic"
 	"othello/data_access"
 	"othello/service"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -23,6 +26,38 @@ func main() {
 	}
 	defer db.Close()
 
+	// Create or upgrade the game tables
+	if err := data_access.Migrate(context.Background()); err != nil {
+		log.Fatalf("failed to migrate DB: %v", err)
+	}
+
+	// Chat flood limits, overridable with CHAT_* variables (see business_logic.ChatLimitsFromEnv)
+	chatLimits, err := business_logic.ChatLimitsFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("invalid chat limits: %v", err)
+	}
+	service.ChatFlood.SetLimits(chatLimits)
+
+	// Chat word filter (CHAT_WORD_FILTER, CHAT_WORD_FILTER_MODE) and moderators
+	// granted at start-up (CHAT_MODERATORS, comma-separated)
+	wordFilter, err := business_logic.WordFilterFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("invalid chat word filter: %v", err)
+	}
+	business_logic.SetChatWordFilter(wordFilter)
+	for _, name := range strings.Split(os.Getenv("CHAT_MODERATORS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if err := data_access.SetModerator(context.Background(), name, true); err != nil {
+				log.Fatalf("failed to make %s a moderator: %v", name, err)
+			}
+		}
+	}
+
+	// Restart the flag timers of timed games still in progress
+	if err := service.ResumeFlagTimers(context.Background()); err != nil {
+		log.Fatalf("failed to resume game clocks: %v", err)
+	}
+
 	// start with this, to show serving up static files:
 	/*
 		fs := http.FileServer(http.Dir("./static"))
@@ -30,8 +65,10 @@ func main() {
 		http.ListenAndServe("localhost:8080", nil)
 	*/
 
-	// Start the chat hub as a background goroutine
+	// Start the chat hub, presence tracking and the matchmaking queue as background goroutines
 	go service.Hub.Run()
+	go service.Online.Run()
+	go service.Matchmaking.Run()
 
 	// a mux (multiplexer) routes incoming requests to their respective handlers
 	mux := http.NewServeMux()
@@ -48,8 +85,47 @@ func main() {
 	// Protected API endpoints
 	mux.HandleFunc("/turn", service.GetTurnHandler)
 	mux.HandleFunc("/next", service.NextTurnHandler)
+	mux.HandleFunc("POST /api/games", service.CreateGameHandler)
+	mux.HandleFunc("GET /api/games/live", service.LiveGamesHandler)
+	mux.HandleFunc("GET /api/games/{id}", service.GetGameHandler)
+	mux.HandleFunc("POST /api/games/{id}/join", service.JoinGameHandler)
+	mux.HandleFunc("GET /api/games/{id}/analysis", service.GameAnalysisHandler)
+	mux.HandleFunc("GET /api/games/{id}/positions/{ply}", service.GamePositionHandler)
+	mux.HandleFunc("GET /api/games/{id}/export", service.ExportGameHandler)
+	mux.HandleFunc("POST /api/games/import", service.ImportGameHandler)
+	mux.HandleFunc("POST /api/games/computer", service.CreateComputerGameHandler)
+	mux.HandleFunc("GET /api/computer/levels", service.ComputerLevelsHandler)
+	mux.HandleFunc("GET /api/users/online", service.ListHandler)
+	mux.HandleFunc("GET /api/users/{name}/games", service.ListUserGamesHandler)
+	mux.HandleFunc("GET /api/users/{name}/rating", service.GetRatingHandler)
+	mux.HandleFunc("GET /api/users/{name}/rating/history", service.GetRatingHistoryHandler)
+	mux.HandleFunc("GET /api/challenges", service.ListChallengesHandler)
+	mux.HandleFunc("POST /api/challenges", service.CreateChallengeHandler)
+	mux.HandleFunc("POST /api/challenges/{id}/accept", service.AcceptChallengeHandler)
+	mux.HandleFunc("POST /api/challenges/{id}/decline", service.DeclineChallengeHandler)
+	mux.HandleFunc("DELETE /api/challenges/{id}", service.CancelChallengeHandler)
+	mux.HandleFunc("POST /api/queue", service.JoinQueueHandler)
+	mux.HandleFunc("DELETE /api/queue", service.LeaveQueueHandler)
+	mux.HandleFunc("GET /api/dms", service.ListConversationsHandler)
+	mux.HandleFunc("GET /api/dms/{name}", service.GetConversationHandler)
+	mux.HandleFunc("POST /api/dms/{name}", service.SendDirectMessageHandler)
+	mux.HandleFunc("POST /api/dms/{name}/read", service.MarkConversationReadHandler)
+	mux.HandleFunc("GET /api/chat/history", service.GetChatHistoryHandler)
+	mux.HandleFunc("POST /api/chat/messages/{id}/report", service.ReportMessageHandler)
+	mux.HandleFunc("POST /api/moderation/users/{name}/mute", service.MuteUserHandler)
+	mux.HandleFunc("DELETE /api/moderation/users/{name}/mute", service.UnmuteUserHandler)
+	mux.HandleFunc("POST /api/moderation/users/{name}/ban", service.BanUserHandler)
+	mux.HandleFunc("DELETE /api/moderation/users/{name}/ban", service.UnbanUserHandler)
+	mux.HandleFunc("POST /api/moderation/users/{name}/clear", service.ClearUserHistoryHandler)
+	mux.HandleFunc("DELETE /api/moderation/messages/{id}", service.ModeratorDeleteMessageHandler)
+	mux.HandleFunc("GET /api/moderation/reports", service.ListReportsHandler)
+	mux.HandleFunc("POST /api/moderation/reports/{id}/resolve", service.ResolveReportHandler)
+	mux.HandleFunc("GET /api/moderation/log", service.ModerationLogHandler)
 	mux.HandleFunc("/ws/chat", service.ChatHandler)
+	mux.HandleFunc("/ws/game/{id}", service.GameHandler)
 	mux.HandleFunc("/board", service.BoardHandler)
+	mux.HandleFunc("/leaderboard", service.LeaderboardHandler)
+	mux.HandleFunc("GET /api/leaderboard", service.LeaderboardAPIHandler)
 
 	// Root (/) serves login page
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"othello/ai"
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// Endgame analysis settings. A whole request shares one deadline, so a
+// window the solver cannot finish in time fails with a timeout instead of
+// tying up the server; the default window finishes well inside it. Only a
+// few analyses run at once.
+const (
+	defaultAnalysisEmpties = 14
+	analysisBudget         = 10 * time.Second
+	maxConcurrentAnalyses  = 2
+)
+
+// analysisKey identifies a cached analysis; finished games never change.
+type analysisKey struct {
+	gameID  int64
+	empties int
+}
+
+var (
+	analysisMu    sync.Mutex
+	analysisCache = make(map[analysisKey][]ai.MoveAnalysis)
+	analysisSlots = make(chan struct{}, maxConcurrentAnalyses)
+)
+
+// errAnalysisBusy is returned while every analysis slot stays taken.
+var errAnalysisBusy = errors.New("too many analyses are running; try again shortly")
+
+// analyze returns the cached analysis for key, or runs it once a slot is
+// free. A request whose slot does not come up within analysisBudget gets
+// errAnalysisBusy. Only finished analyses are cached: a timeout may have
+// been a busy moment, so a retry runs again.
+func analyze(r *http.Request, key analysisKey, moves []data_access.Move) ([]ai.MoveAnalysis, error) {
+	if res, ok := cachedAnalysis(key); ok {
+		return res, nil
+	}
+	select {
+	case analysisSlots <- struct{}{}:
+		defer func() { <-analysisSlots }()
+	case <-time.After(analysisBudget):
+		return nil, errAnalysisBusy
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+	// Another request may have run the same analysis while this one waited.
+	if res, ok := cachedAnalysis(key); ok {
+		return res, nil
+	}
+
+	res, err := ai.AnalyzeEndgame(moves, key.empties, time.Now().Add(analysisBudget))
+	if err != nil {
+		return nil, err
+	}
+	analysisMu.Lock()
+	analysisCache[key] = res
+	analysisMu.Unlock()
+	return res, nil
+}
+
+func cachedAnalysis(key analysisKey) ([]ai.MoveAnalysis, bool) {
+	analysisMu.Lock()
+	defer analysisMu.Unlock()
+	res, ok := analysisCache[key]
+	return res, ok
+}
+
+// GameAnalysisHandler returns a perfect-play analysis of a finished game's
+// endgame: for every move from the point where ?empties= squares (default
+// 14, max ai.MaxSolveEmpties) were left, the best move, the result it would have led to and
+// how many discs the move actually played gave away. Totals per color show
+// where each player lost points.
+func GameAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	empties := defaultAnalysisEmpties
+	if q := r.URL.Query().Get("empties"); q != "" {
+		v, err := strconv.Atoi(q)
+		if err != nil || v < 1 || v > ai.MaxSolveEmpties {
+			jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "empties must be between 1 and " + strconv.Itoa(ai.MaxSolveEmpties)})
+			return
+		}
+		empties = v
+	}
+
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	// Analysing a live game would hand a player the solution.
+	if g.Status != data_access.GameFinished {
+		jsonResponse(w, http.StatusConflict, map[string]string{"error": "only finished games can be analysed"})
+		return
+	}
+
+	moves, err := analyze(r, analysisKey{id, empties}, g.Moves)
+	switch {
+	case errors.Is(err, ai.ErrSolveTimeout):
+		jsonResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "analysis took too long; try fewer empties"})
+		return
+	case errors.Is(err, errAnalysisBusy):
+		jsonResponse(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	lost := map[string]int{"black": 0, "white": 0}
+	out := make([]map[string]interface{}, 0, len(moves))
+	for _, m := range moves {
+		lost[m.Color] += m.Loss
+		out = append(out, map[string]interface{}{
+			"ply":         m.Ply,
+			"color":       m.Color,
+			"square":      m.Square,
+			"bestSquare":  m.BestSquare,
+			"bestScore":   m.BestScore,
+			"playedScore": m.PlayedScore,
+			"loss":        m.Loss,
+		})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"gameId":  id,
+		"empties": empties,
+		"moves":   out,
+		"lost":    lost,
+	})
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// challengeView is the JSON form of a pending challenge.
+func challengeView(c data_access.Challenge) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          c.ID,
+		"from":        c.From,
+		"to":          c.To,
+		"color":       c.Color,
+		"timeControl": c.TimeControl,
+		"rated":       c.Rated,
+		"created":     c.CreatedAt.Format(time.RFC3339),
+		"expires":     c.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+// notifyChallenge pushes a challenge event over the lobby WebSocket to both
+// sides of a challenge. Open seeks are announced to the whole lobby.
+func notifyChallenge(event string, c data_access.Challenge) {
+	msg := map[string]interface{}{"type": event, "challenge": challengeView(c)}
+	if c.To == "" {
+		Hub.Notify("", msg)
+		return
+	}
+	Hub.Notify(c.From, msg)
+	Hub.Notify(c.To, msg)
+}
+
+// challengeErrorStatus maps challenge errors to HTTP status codes.
+func challengeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, data_access.ErrChallengeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, business_logic.ErrChallengeForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, business_logic.ErrChallengeExpired):
+		return http.StatusGone
+	}
+	return http.StatusBadRequest
+}
+
+// ListChallengesHandler returns the challenges the caller sent, received, or can accept.
+func ListChallengesHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	out := make([]map[string]interface{}, 0)
+	for _, c := range data_access.ListChallenges(username) {
+		out = append(out, challengeView(c))
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"challenges": out})
+}
+
+// CreateChallengeHandler challenges a specific online user ({"to": "bob"})
+// or posts an open seek (no "to"). The optional "color" is the color the
+// challenger wants to play, "timeControl" the clock (e.g. "5+3") and
+// "rated" whether the result counts towards ratings.
+func CreateChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	var req struct {
+		To          string `json:"to"`
+		Color       string `json:"color"`
+		TimeControl string `json:"timeControl"`
+		Rated       bool   `json:"rated"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if req.To != "" && !Hub.IsOnline(req.To) {
+		jsonResponse(w, http.StatusConflict, map[string]string{"error": req.To + " is not online"})
+		return
+	}
+
+	c, err := business_logic.CreateChallenge(username, req.To, req.Color, req.TimeControl, req.Rated)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Expire the challenge if nobody acts on it in time.
+	time.AfterFunc(time.Until(c.ExpiresAt), func() {
+		if expired, err := business_logic.ExpireChallenge(c.ID); err == nil {
+			notifyChallenge("challengeExpired", expired)
+		}
+	})
+
+	notifyChallenge("challenge", c)
+	jsonResponse(w, http.StatusCreated, challengeView(c))
+}
+
+// AcceptChallengeHandler accepts a challenge, creates the game and sends
+// both players a gameStart event pointing at it.
+func AcceptChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	c, g, err := business_logic.AcceptChallenge(r.PathValue("id"), username)
+	if err != nil {
+		jsonResponse(w, challengeErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("challenge %s accepted by %s: game %d", c.ID, username, g.ID)
+
+	// Let everyone who saw the challenge drop it, then send the players to the game.
+	notifyChallenge("challengeAccepted", c)
+	start := map[string]interface{}{"type": "gameStart", "gameId": g.ID, "black": g.Black, "white": g.White}
+	Hub.Notify(g.Black, start)
+	Hub.Notify(g.White, start)
+
+	jsonResponse(w, http.StatusOK, gameState(g))
+}
+
+// DeclineChallengeHandler declines a challenge addressed to the caller.
+func DeclineChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	c, err := business_logic.DeclineChallenge(r.PathValue("id"), username)
+	if err != nil {
+		jsonResponse(w, challengeErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	notifyChallenge("challengeDeclined", c)
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "declined"})
+}
+
+// CancelChallengeHandler withdraws a challenge the caller sent.
+func CancelChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	c, err := business_logic.CancelChallenge(r.PathValue("id"), username)
+	if err != nil {
+		jsonResponse(w, challengeErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	notifyChallenge("challengeCancelled", c)
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
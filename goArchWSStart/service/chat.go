@@ -2,13 +2,15 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"othello/business_logic"
 	"othello/data_access"
 
 	"github.com/gorilla/websocket"
@@ -24,12 +26,156 @@ var upgrader = websocket.Upgrader{
 }
 
 // ChatMessage is the payload exchanged over WebSockets.
-// It currently carries the raw message text and an ISO timestamp string.
+// It carries the message text and ISO timestamp strings. ID, Room, Tokens and
+// the times are set by the server when the message is stored; clients refer
+// to a message by its ID to edit or delete it. Message is the raw text with
+// its markup; Tokens is the same text parsed for display.
 type ChatMessage struct {
-	Account_Token string `json:"account_token,omitempty"`
-	Username      string `json:"username,omitempty"`
-	Message       string `json:"message"`
-	Time          string `json:"time,omitempty"`
+	ID       int64       `json:"id,omitempty"`
+	Room     string      `json:"room,omitempty"`
+	Username string      `json:"username,omitempty"`
+	Message  string      `json:"message"`
+	Tokens   []chatToken `json:"tokens,omitempty"`
+	Time     string      `json:"time,omitempty"`
+	Edited   bool        `json:"edited,omitempty"`
+	EditedAt string      `json:"editedAt,omitempty"`
+}
+
+// chatToken is the wire form of a business_logic.ChatToken: a run of plain
+// text, bold text, code, or a link. Clients show Text as text, never as
+// HTML.
+type chatToken struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Href string `json:"href,omitempty"`
+}
+
+// chatTokens parses a message's markup for the wire.
+func chatTokens(text string) []chatToken {
+	tokens := business_logic.ParseChatMarkup(text)
+	out := make([]chatToken, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, chatToken{Type: t.Kind, Text: t.Text, Href: t.Href})
+	}
+	return out
+}
+
+// chatView converts a stored message to its wire form. The sender's
+// account token stays on the server.
+func chatView(m data_access.ChatMessage) ChatMessage {
+	v := ChatMessage{
+		ID:       m.Message_ID,
+		Room:     m.Room_ID,
+		Username: m.Username,
+		Message:  m.Message,
+		Tokens:   chatTokens(m.Message),
+		Time:     m.Chat_Date.UTC().Format(time.RFC3339),
+	}
+	if !m.Edited_At.IsZero() {
+		v.Edited = true
+		v.EditedAt = m.Edited_At.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// chatEdit is the payload of "chatEdit" and "chatDelete" frames, which
+// change one of the sender's own messages.
+type chatEdit struct {
+	ID      int64  `json:"id"`
+	Message string `json:"message,omitempty"` // the new text for "chatEdit"
+}
+
+// LobbyRoom is the chat room of the lobby. Each game also has a room,
+// "game:<id>", that only its two players can join.
+const LobbyRoom = "lobby"
+
+// gameRoom returns the chat room of a game's players.
+func gameRoom(gameID int64) string {
+	return "game:" + strconv.FormatInt(gameID, 10)
+}
+
+// errNotInRoom is returned when a user may not join a chat room.
+var errNotInRoom = errors.New("only the game's players can use its chat")
+
+// gameRoomID returns the game a "game:<id>" room belongs to.
+func gameRoomID(room string) (int64, bool) {
+	idText, ok := strings.CutPrefix(room, "game:")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idText, 10, 64)
+	return id, err == nil
+}
+
+// resolveChatRoom checks the room a user asked to join ("" means the lobby)
+// and returns its canonical name.
+func resolveChatRoom(room, username string) (string, error) {
+	if room == "" || room == LobbyRoom {
+		return LobbyRoom, nil
+	}
+	id, ok := gameRoomID(room)
+	if !ok {
+		return "", errors.New("unknown chat room " + room)
+	}
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		return "", err
+	}
+	if g.ColorOf(username) == "" {
+		return "", errNotInRoom
+	}
+	return gameRoom(id), nil
+}
+
+// chatClient is one chat WebSocket connection, the user it belongs to, the
+// room it joined and the protocol version it speaks. flood is the
+// connection's own chat rate limit (see FloodGuard).
+type chatClient struct {
+	conn     *websocket.Conn
+	username string
+	room     string
+	version  int
+	flood    business_logic.TokenBucket
+}
+
+// send writes a message to the client in its protocol version; id is the
+// client frame it answers, if any. Only the hub's Run loop may call it.
+func (c *chatClient) send(id string, msg interface{}) error {
+	return writeFrame(c.conn, c.version, id, msg)
+}
+
+// chatReply is a message for one connection, usually the answer to a frame
+// it sent.
+type chatReply struct {
+	client *chatClient
+	id     string
+	msg    interface{}
+}
+
+// roomMessage is a message for every connection in one chat room: a new
+// chat message, or an edit or deletion of one.
+type roomMessage struct {
+	room string
+	msg  interface{}
+}
+
+// publishChat sends a message to everyone in a chat room: the room's chat
+// sockets through Hub and, for a game room, the players on the game socket.
+// It must not be called from a GameHub's Run loop; see GameHub.publishChat.
+func publishChat(room string, msg interface{}) {
+	Hub.broadcast <- roomMessage{room: room, msg: msg}
+	if id, ok := gameRoomID(room); ok {
+		forwardGameChat(id, msg)
+	}
+}
+
+// directMessage is a server notification for the lobby connections of one
+// user (or, with an empty `to`, for every lobby connection). With anyRoom it
+// goes to the user's connections in every room.
+type directMessage struct {
+	to      string
+	msg     interface{}
+	anyRoom bool
 }
 
 // ChatHub coordinates all chat activity.
@@ -37,27 +183,80 @@ type ChatMessage struct {
 // Concurrency model:
 // - clients: set of active WebSocket connections (guarded by mu)
 // - register/unregister: channels to add/remove clients (serialized by Run loop)
-// - broadcast: channel to fan messages out to all connected clients
-// - messages: in-memory history; appended to on each broadcast (you'd replace with DB table)
-// - mu: protects both clients and messages across goroutines
+// - broadcast: channel to fan messages out to the connections in the message's room
+// - direct: channel of server notifications (e.g. challenges) for specific users
+// - replies: channel of acks and errors for single connections
+// - mu: protects clients across goroutines
+//
+// Messages are stored (data_access) before they are broadcast, so every
+// message goes out with its ID.
 type ChatHub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan ChatMessage
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	messages   []ChatMessage
-	users      []User
+	clients    map[*chatClient]bool
+	broadcast  chan roomMessage
+	direct     chan directMessage
+	replies    chan chatReply
+	register   chan *chatClient
+	unregister chan *chatClient
 	mu         sync.RWMutex
 }
 
 // Hub is the single global instance used by the server.
 var Hub = &ChatHub{
-	clients:    make(map[*websocket.Conn]bool),
-	broadcast:  make(chan ChatMessage),
-	register:   make(chan *websocket.Conn),
-	unregister: make(chan *websocket.Conn),
-	messages:   make([]ChatMessage, 0),
-	users:      make([]User, 0),
+	clients:    make(map[*chatClient]bool),
+	broadcast:  make(chan roomMessage),
+	direct:     make(chan directMessage),
+	replies:    make(chan chatReply),
+	register:   make(chan *chatClient),
+	unregister: make(chan *chatClient),
+}
+
+// Notify queues a notification for every lobby connection of username.
+// An empty username sends it to everyone in the lobby. Game chat rooms
+// never receive notifications; NotifyUser reaches every connection.
+func (h *ChatHub) Notify(username string, msg interface{}) {
+	h.direct <- directMessage{to: username, msg: msg}
+}
+
+// NotifyUser sends a message to every open connection of username: their
+// chat sockets in any room and their game sockets, as players or
+// spectators. Direct messages go out this way. Like publishChat it must not
+// be called from a GameHub's Run loop.
+func NotifyUser(username string, msg interface{}) {
+	Hub.direct <- directMessage{to: username, msg: msg, anyRoom: true}
+	notifyGameSockets(username, msg)
+}
+
+// reply queues a message for one connection; id is the client frame it
+// answers, if any.
+func (h *ChatHub) reply(client *chatClient, id string, msg interface{}) {
+	h.replies <- chatReply{client: client, id: id, msg: msg}
+}
+
+// history returns up to limit of a room's latest messages, oldest first.
+func (h *ChatHub) history(room string, limit int) []ChatMessage {
+	msgs, err := data_access.GetMessages(context.Background(), room, limit)
+	if err != nil {
+		log.Printf("Error reading chat history: %v", err)
+		return nil
+	}
+	// DB returns messages newest-first
+	out := make([]ChatMessage, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		out = append(out, chatView(msgs[i]))
+	}
+	return out
+}
+
+// IsOnline reports whether username has at least one lobby connection open.
+func (h *ChatHub) IsOnline(username string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.room == LobbyRoom && client.username == username {
+			return true
+		}
+	}
+	return false
 }
 
 // Run is the event loop for the hub. It should be started once (e.g., in main)
@@ -84,31 +283,22 @@ func (h *ChatHub) Run() {
 			// Release the Mutex lock after modification.
 			h.mu.Unlock()
 
-			// Send chat history to the new client. Try DB first, fall back to in-memory.
-			ctx := context.Background()
-			msgs, err := data_access.GetMessages(ctx, 100)
-			if err == nil {
-				// DB returns messages newest-first; send them oldest-first to clients
-				for i := len(msgs) - 1; i >= 0; i-- {
-					dm := msgs[i]
-					sm := ChatMessage{
-						Account_Token: dm.Account_Token,
-						Username:      dm.Username,
-						Message:       dm.Message,
-						Time:          dm.Chat_Date.Format(time.RFC3339),
-					}
-					if err := client.WriteJSON(sm); err != nil {
+			// Send the room's chat history to a version 0 client, oldest
+			// first. Newer clients page through /api/chat/history instead.
+			if client.version == 0 {
+				for _, msg := range h.history(client.room, 100) {
+					if err := client.send("", msg); err != nil {
 						log.Printf("Error sending history: %v", err)
 					}
 				}
-			} else {
-				h.mu.RLock()
-				for _, msg := range h.messages {
-					if err := client.WriteJSON(msg); err != nil {
-						log.Printf("Error sending history: %v", err)
-					}
+			}
+
+			// The lobby also shows who is online; changes follow as
+			// "presence" notifications.
+			if client.room == LobbyRoom {
+				if err := client.send("", map[string]interface{}{"type": "userList", "users": Online.Snapshot()}); err != nil {
+					log.Printf("Error sending user list: %v", err)
 				}
-				h.mu.RUnlock()
 			}
 
 		// A client disconnected or errored.
@@ -118,94 +308,59 @@ func (h *ChatHub) Run() {
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				client.Close()
+				client.conn.Close()
 			}
 			h.mu.Unlock()
 
-		// A client sent a message to broadcast to all other clients.
+		// The server has a notification for one user (or everyone).
 		//
-		// Dequeue the message from the broadcast channel, store it in the
-		// in-memory history, and fan it out to all connected clients.
-		case message := <-h.broadcast:
-			// Sanitize `message` here to prevent XSS
-
-			// Store message in memory and persist to DB
+		// Only that user's connections receive it; chat history is not touched.
+		case dm := <-h.direct:
 			h.mu.Lock()
-			h.messages = append(h.messages, message)
-			h.mu.Unlock()
-
-			// Persist to DB (best-effort; log errors)
-			go func(m ChatMessage) {
-				ctx := context.Background()
-				// convert time if provided, otherwise DB will set timestamp
-				if _, err := data_access.InsertMessage(ctx, m.Account_Token, m.Username, m.Message); err != nil {
-					log.Printf("Error inserting chat message: %v", err)
-				}
-			}(message)
-
-			// Broadcast to all connected clients. If a client write fails,
-			// close and drop that client to avoid leaking dead connections.
-			h.mu.RLock()
 			for client := range h.clients {
-				if err := client.WriteJSON(message); err != nil {
-					log.Printf("Error broadcasting: %v", err)
-					client.Close()
+				if (client.room != LobbyRoom && !dm.anyRoom) || (dm.to != "" && client.username != dm.to) {
+					continue
+				}
+				if err := client.send("", dm.msg); err != nil {
+					log.Printf("Error sending notification: %v", err)
+					client.conn.Close()
 					delete(h.clients, client)
 				}
 			}
+			h.mu.Unlock()
+
+		// The server is answering one connection, e.g. acking its message.
+		// The client may have left in the meantime.
+		case r := <-h.replies:
+			h.mu.RLock()
+			_, ok := h.clients[r.client]
 			h.mu.RUnlock()
-		}
-	}
-}
+			if !ok {
+				continue
+			}
+			if err := r.client.send(r.id, r.msg); err != nil {
+				log.Printf("Error sending reply: %v", err)
+			}
 
-func (h *UserHub) Run() {
-	for {
-		select {
+		// A client's message (or an edit or deletion of one) was stored and
+		// goes out to the clients in its room.
+		case message := <-h.broadcast:
+			// Messages were checked by business_logic.CleanChatMessage
+			// before they were stored, and clients render them from
+			// their tokens as text, so nothing here is HTML.
 
-		// A new client has connected.
-		//
-		// h.register is a channel of *websocket.Conn values; this of it as a message queue.
-		// The left arrow means to dequeue a value from that channel when one is available.
-		// In this case, it means that a new client has connected.
-		case client := <-h.register:
-			// The Go Mutex lock ensures that the clients map is safely modified.
+			// Broadcast to the room's clients. If a client write fails,
+			// close and drop that client to avoid leaking dead connections.
 			h.mu.Lock()
-			h.clients[client] = true
-			// Release the Mutex lock after modification.
-			h.mu.Unlock()
-
-			// Send chat history to the new client. Try DB first, fall back to in-memory.
-			usrs, err := data_access.GetOnlineUsers()
-			if err == nil {
-				// DB returns messages newest-first; send them oldest-first to clients
-				for i := len(usrs) - 1; i >= 0; i-- {
-					dm := usrs[i]
-					sm := User{
-						Account_Token: dm.Account_Token,
-						Username:      dm.Username,
-					}
-					if err := client.WriteJSON(sm); err != nil {
-						log.Printf("Error sending history: %v", err)
-					}
+			for client := range h.clients {
+				if client.room != message.room {
+					continue
 				}
-			} else {
-				h.mu.RLock()
-				for _, msg := range h.users {
-					if err := client.WriteJSON(msg); err != nil {
-						log.Printf("Error sending history: %v", err)
-					}
+				if err := client.send("", message.msg); err != nil {
+					log.Printf("Error broadcasting: %v", err)
+					client.conn.Close()
+					delete(h.clients, client)
 				}
-				h.mu.RUnlock()
-			}
-
-		// A client disconnected or errored.
-		//
-		// Remove the client from the hub and close the connection.
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Close()
 			}
 			h.mu.Unlock()
 		}
@@ -214,98 +369,222 @@ func (h *UserHub) Run() {
 
 // ChatHandler upgrades the HTTP request to a WebSocket and then pumps
 // incoming messages from that client into the hub's broadcast channel.
+// The ?room= query parameter picks the room; it defaults to the lobby.
+// ?v= picks the protocol version (see protocol.go).
 // Lifecycle:
-// 1) Upgrade to WebSocket
-// 2) Register client with hub (triggers history replay)
-// 3) Loop reading JSON ChatMessage values and forward to hub
-// 4) On error/close, unregister client
+//  1. Resolve the session user (in memory or in the account table) and check
+//     they may join the room
+//  2. Upgrade to WebSocket
+//  3. Register client with hub (replays history to version 0 clients) and mark the user online
+//  4. Loop reading frames: "chat" posts a message, "chatEdit" and "chatDelete"
+//     change one of the user's own; each change passes the flood limits
+//     (ChatFlood), is stored, published to the room and acked
+//  5. On error/close, unregister client and drop its presence
 func ChatHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
-		return
-	}
-
 	// Capture session info from the initial HTTP request so we can attach
-	// username/account token to messages sent over this WebSocket.
+	// username/account token to messages sent over this WebSocket. Only the
+	// session decides who is chatting; the name a frame carries is ignored.
 	var sessToken string
-	var sessUser string
 	if c, err := r.Cookie("session"); err == nil {
 		sessToken = c.Value
-		if u, ok := lookupSession(sessToken); ok {
-			sessUser = u
-		}
 	}
+	sessUser, _ := sessionUsername(r)
 
-	Hub.register <- conn
+	version, err := protocolVersion(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	room, err := resolveChatRoom(r.URL.Query().Get("room"), sessUser)
+	if errors.Is(err, errNotInRoom) {
+		jsonResponse(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	client := &chatClient{conn: conn, username: sessUser, room: room, version: version}
+	Hub.register <- client
+	Online.Connected(sessUser, 0)
 
 	// The defer keyword delays execution of the function until the surrounding
 	// function (ChatHandler) returns. Here, it ensures that the client is
 	// unregistered from the hub when this function exits (e.g., on error or close)
 	// and that resources are cleaned up.
 	defer func() {
-		Hub.unregister <- conn
+		Hub.unregister <- client
+		Online.Disconnected(sessUser, 0)
 	}()
 
 	for {
-		var msg ChatMessage
-		err := conn.ReadJSON(&msg)
-		if err != nil {
+		env, err := readFrame(conn, version)
+		if errors.Is(err, errBadFrame) {
+			Hub.reply(client, env.ID, errorMessage(err.Error()))
+			continue
+		} else if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
-
-		// Enrich message with server-side session info if available.
-		if sessUser != "" {
-			msg.Username = sessUser
-		}
-		if sessToken != "" {
-			msg.Account_Token = sessToken
+		if isChatAction(env.Type) {
+			if sessUser == "" {
+				Hub.reply(client, env.ID, errorMessage("sign in to chat"))
+				continue
+			}
+			var throttled *throttleError
+			if err := ChatFlood.Check(sessUser, &client.flood); errors.As(err, &throttled) {
+				Hub.reply(client, env.ID, throttled.message())
+				continue
+			}
 		}
-		if msg.Time == "" {
-			msg.Time = time.Now().UTC().Format(time.RFC3339)
+		switch env.Type {
+		case "chat":
+			var msg ChatMessage
+			if err := decodePayload(env, &msg); err != nil {
+				Hub.reply(client, env.ID, errorMessage(err.Error()))
+				continue
+			}
+			m, err := business_logic.PostChatMessage(room, sessToken, sessUser, msg.Message)
+			if err != nil {
+				Hub.reply(client, env.ID, errorMessage(err.Error()))
+				continue
+			}
+			// The ack follows the broadcast, so the sender sees its own message first.
+			publishChat(room, chatView(m))
+
+		case "chatEdit":
+			var edit chatEdit
+			if err := decodePayload(env, &edit); err != nil {
+				Hub.reply(client, env.ID, errorMessage(err.Error()))
+				continue
+			}
+			m, err := business_logic.EditChatMessage(room, edit.ID, sessUser, edit.Message)
+			if err != nil {
+				Hub.reply(client, env.ID, errorMessage(err.Error()))
+				continue
+			}
+			publishChat(room, map[string]interface{}{"type": "chatEdited", "message": chatView(m)})
+
+		case "chatDelete":
+			var del chatEdit
+			if err := decodePayload(env, &del); err != nil {
+				Hub.reply(client, env.ID, errorMessage(err.Error()))
+				continue
+			}
+			if err := business_logic.DeleteChatMessage(room, del.ID, sessUser); err != nil {
+				Hub.reply(client, env.ID, errorMessage(err.Error()))
+				continue
+			}
+			publishChat(room, map[string]interface{}{"type": "chatDeleted", "id": del.ID, "room": room})
+
+		default:
+			Hub.reply(client, env.ID, errorMessage("unknown message type "+env.Type))
+			continue
 		}
+		Hub.reply(client, env.ID, ackMessage)
+	}
+}
+
+// Chat history pages: ?limit= defaults to defaultHistoryPage and is capped
+// at maxHistoryPage.
+const (
+	defaultHistoryPage = 50
+	maxHistoryPage     = 100
+)
 
-		Hub.broadcast <- msg
+// historyCursor parses an optional message ID cursor (?before= or ?after=).
+func historyCursor(r *http.Request, name string) (int64, error) {
+	q := r.URL.Query().Get(name)
+	if q == "" {
+		return 0, nil
 	}
+	v, err := strconv.ParseInt(q, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, errors.New("invalid " + name + " cursor")
+	}
+	return v, nil
 }
 
-// GetChatHistoryHandler returns the current in-memory message history as JSON.
-// This can be useful for non-WebSocket clients or debugging.
+// GetChatHistoryHandler returns one page of a chat room's messages, oldest
+// first. ?room= picks the room (default the lobby); game rooms are only
+// readable by the game's players.
+//
+// Without a cursor the page holds the room's latest messages. ?before=<id>
+// goes back from a message, e.g. the oldest one the client shows, and the
+// response's "older" cursor is set while there are more. ?after=<id> catches
+// up on messages newer than one, e.g. after a reconnect, with a "newer"
+// cursor while there are more. ?limit= is at most 100 (default 50).
 func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	// Optional `limit` query parameter, default 100
-	limit := 100
+	username, _ := sessionUsername(r)
+	room, err := resolveChatRoom(r.URL.Query().Get("room"), username)
+	if errors.Is(err, errNotInRoom) {
+		jsonResponse(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	limit := defaultHistoryPage
 	if q := r.URL.Query().Get("limit"); q != "" {
 		if v, err := strconv.Atoi(q); err == nil && v > 0 {
-			limit = v
+			limit = min(v, maxHistoryPage)
 		}
 	}
+	before, err := historyCursor(r, "before")
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	after, err := historyCursor(r, "after")
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if before > 0 && after > 0 {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "use either before or after, not both"})
+		return
+	}
 
-	ctx := r.Context()
-	msgs, err := data_access.GetMessages(ctx, limit)
+	// One extra message tells whether there is another page.
+	msgs, err := data_access.GetMessagePage(r.Context(), room, before, after, limit+1)
 	if err != nil {
-		// Fall back to in-memory history if DB read fails
-		log.Printf("DB chat history read failed: %v; returning in-memory messages", err)
-		Hub.mu.RLock()
-		defer Hub.mu.RUnlock()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Hub.messages)
+		log.Printf("DB chat history read failed: %v", err)
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not read chat history"})
 		return
 	}
+	more := len(msgs) > limit
+	if more {
+		msgs = msgs[:limit]
+	}
 
-	// Map DB messages to wire ChatMessage
 	out := make([]ChatMessage, 0, len(msgs))
-	for _, m := range msgs {
-		out = append(out, ChatMessage{
-			Account_Token: m.Account_Token,
-			Username:      m.Username,
-			Message:       m.Message,
-			Time:          m.Chat_Date.Format(time.RFC3339),
-		})
+	resp := map[string]interface{}{"room": room}
+	if after > 0 {
+		// Already oldest first.
+		for _, m := range msgs {
+			out = append(out, chatView(m))
+		}
+		if more {
+			resp["newer"] = out[len(out)-1].ID
+		}
+	} else {
+		// DB returns messages newest-first
+		for i := len(msgs) - 1; i >= 0; i-- {
+			out = append(out, chatView(msgs[i]))
+		}
+		if more {
+			resp["older"] = out[0].ID
+		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(out)
+	resp["messages"] = out
+	jsonResponse(w, http.StatusOK, resp)
 }
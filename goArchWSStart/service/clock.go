@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// flagTimers holds one pending flag check per game whose clock is running.
+// The timer fires when the side to move runs out of time, so a game is
+// decided on time even if both players have gone quiet or closed the page.
+var (
+	flagTimersMu sync.Mutex
+	flagTimers   = make(map[int64]*time.Timer)
+)
+
+// armFlagTimer (re)schedules the flag check for a game from its current
+// clocks, replacing any earlier timer. If no clock is running the timer is
+// just cancelled.
+func armFlagTimer(g data_access.Game) {
+	left, running := business_logic.TimeUntilFlag(g, time.Now())
+
+	flagTimersMu.Lock()
+	defer flagTimersMu.Unlock()
+	if t, ok := flagTimers[g.ID]; ok {
+		t.Stop()
+		delete(flagTimers, g.ID)
+	}
+	if !running {
+		return
+	}
+	id := g.ID
+	flagTimers[id] = time.AfterFunc(left, func() { checkFlag(id) })
+}
+
+// ResumeFlagTimers loads the timed games left active by the last run and arms
+// their flag timers, so they are still decided on time after a restart
+// without anyone opening them. Loading restarts the running clock, so time
+// the server was down is not charged (see business_logic.LoadGame).
+func ResumeFlagTimers(ctx context.Context) error {
+	ids, err := data_access.ActiveTimedGameIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		g, err := business_logic.LoadGame(id)
+		if err != nil {
+			log.Printf("Error resuming clock of game %d: %v", id, err)
+			continue
+		}
+		armFlagTimer(g)
+	}
+	return nil
+}
+
+// checkFlag runs when a flag timer fires. A move may have landed just before
+// it, in which case the game is still live and the timer is re-armed.
+func checkFlag(gameID int64) {
+	g, flagged, err := business_logic.FlagGame(gameID)
+	if err != nil {
+		log.Printf("Error checking clock of game %d: %v", gameID, err)
+		return
+	}
+	if !flagged {
+		armFlagTimer(g)
+		return
+	}
+	log.Printf("Game %d: %s ran out of time", gameID, g.PlayerFor(loserOf(g)))
+	notifyGameUpdate(g, nil)
+}
+
+// loserOf returns the color that lost a decided game, or "" for a draw.
+func loserOf(g data_access.Game) string {
+	switch g.Result {
+	case "black":
+		return "white"
+	case "white":
+		return "black"
+	}
+	return ""
+}
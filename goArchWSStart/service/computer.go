@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+
+	"othello/ai"
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// computerThinking marks games where a computer move is being searched, so
+// overlapping triggers (a move, a reconnect) never start a second search.
+var (
+	computerMu       sync.Mutex
+	computerThinking = make(map[int64]bool)
+)
+
+// scheduleComputerMove starts the computer's reply if a computer player is
+// to move in g. The search runs in its own goroutine and the move goes in
+// through PlayGameMove and notifyGameUpdate like any other outside change,
+// so this is safe to call from a GameHub's Run loop: the hub is never made
+// to wait on itself.
+func scheduleComputerMove(g data_access.Game) {
+	if g.Status != data_access.GameActive {
+		return
+	}
+	name := g.PlayerFor(g.ToMove)
+	level, ok := ai.LevelOf(name)
+	if !ok {
+		return
+	}
+
+	computerMu.Lock()
+	if computerThinking[g.ID] {
+		computerMu.Unlock()
+		return
+	}
+	computerThinking[g.ID] = true
+	computerMu.Unlock()
+
+	go func(id int64) {
+		g, res, err := playComputerMove(g, name, level)
+
+		computerMu.Lock()
+		delete(computerThinking, id)
+		computerMu.Unlock()
+
+		switch {
+		case errors.Is(err, business_logic.ErrFlagFell):
+			notifyGameUpdate(g, nil)
+		case err != nil:
+			log.Printf("Computer move in game %d failed: %v", id, err)
+		default:
+			// notifyGameUpdate schedules the next computer move if the
+			// opponent has to pass.
+			notifyGameUpdate(g, &res)
+		}
+	}(g.ID)
+}
+
+// playComputerMove searches and plays the computer's move in g.
+func playComputerMove(g data_access.Game, name string, level ai.Level) (data_access.Game, business_logic.MoveResult, error) {
+	p, err := business_logic.GamePosition(g)
+	if err != nil {
+		return g, business_logic.MoveResult{}, err
+	}
+	sq, err := ai.ChooseMove(p, level)
+	if err != nil {
+		return g, business_logic.MoveResult{}, err
+	}
+	return business_logic.PlayGameMove(g.ID, name, business_logic.SquareName(sq))
+}
+
+// computerAnswer is a computer opponent's reply to a human's game action.
+type computerAnswer struct {
+	game    data_access.Game
+	action  string // the command the computer sent in reply
+	by      string // the computer's color
+	rematch *data_access.Game
+}
+
+// computerResponds lets a computer opponent answer a human's game action:
+// it always agrees to a rematch and plays on rather than take a draw.
+// ok is false when there is nothing to answer.
+func computerResponds(g data_access.Game, action string) (answer computerAnswer, ok bool) {
+	for _, color := range []string{"black", "white"} {
+		name := g.PlayerFor(color)
+		if _, isComputer := ai.LevelOf(name); !isComputer {
+			continue
+		}
+		switch action {
+		case "offerDraw":
+			if g.DrawOffer == "" || g.DrawOffer == color {
+				return answer, false
+			}
+			updated, err := business_logic.AnswerDraw(g.ID, name, false)
+			if err != nil {
+				return answer, false
+			}
+			return computerAnswer{game: updated, action: "declineDraw", by: color}, true
+		case "rematch":
+			updated, rematch, err := business_logic.OfferRematch(g.ID, name)
+			if err != nil || rematch == nil {
+				return answer, false
+			}
+			scheduleComputerMove(*rematch)
+			return computerAnswer{game: updated, action: "rematch", by: color, rematch: rematch}, true
+		}
+	}
+	return answer, false
+}
+
+// CreateComputerGameHandler starts an unrated game against the computer.
+// The body gives the "level" (see ai.Levels, default "medium"), the caller's
+// "color" ("black", "white" or "random") and an optional "timeControl".
+// If the computer has black its first move is already on the way.
+func CreateComputerGameHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	var req struct {
+		Level       string `json:"level"`
+		Color       string `json:"color"`
+		TimeControl string `json:"timeControl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if req.Level == "" {
+		req.Level = "medium"
+	}
+	level, ok := ai.LevelByName(req.Level)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "unknown level " + req.Level})
+		return
+	}
+
+	black, white := username, ai.PlayerName(level)
+	switch req.Color {
+	case "white":
+		black, white = white, black
+	case "", "black":
+	case "random":
+		if rand.IntN(2) == 1 {
+			black, white = white, black
+		}
+	default:
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "color must be black, white or random"})
+		return
+	}
+
+	g, err := business_logic.NewGame(black, white, req.TimeControl, false)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	scheduleComputerMove(g)
+	jsonResponse(w, http.StatusCreated, gameState(g))
+}
+
+// ComputerLevelsHandler lists the computer's strength levels.
+func ComputerLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	out := make([]map[string]interface{}, 0, len(ai.Levels))
+	for _, l := range ai.Levels {
+		out = append(out, map[string]interface{}{
+			"name":         l.Name,
+			"depth":        l.Depth,
+			"timeBudgetMs": l.TimeBudget.Milliseconds(),
+		})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"levels": out})
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// dmView is the JSON form of a direct message.
+func dmView(m data_access.DirectMessage) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   m.ID,
+		"from": m.From,
+		"to":   m.To,
+		"body": m.Body,
+		"time": m.SentAt.Format(time.RFC3339),
+		"read": !m.ReadAt.IsZero(),
+	}
+}
+
+// ListConversationsHandler lists the caller's conversations, most recent
+// first, each with its latest message and unread count.
+func ListConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	list, err := data_access.ListConversations(r.Context(), username)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve conversations"})
+		return
+	}
+	total := 0
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, c := range list {
+		total += c.Unread
+		out = append(out, map[string]interface{}{
+			"with":   c.With,
+			"last":   dmView(c.Last),
+			"unread": c.Unread,
+		})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"conversations": out, "unread": total})
+}
+
+// GetConversationHandler returns one page of the caller's messages with
+// {name}, newest first. ?before= takes the "next" cursor of the previous
+// page to go further back; ?limit= is at most 100 (default 50).
+func GetConversationHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if v, err := strconv.Atoi(q); err == nil && v > 0 && v <= 100 {
+			limit = v
+		}
+	}
+	var before int64
+	if q := r.URL.Query().Get("before"); q != "" {
+		v, err := strconv.ParseInt(q, 10, 64)
+		if err != nil || v <= 0 {
+			jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid before cursor"})
+			return
+		}
+		before = v
+	}
+
+	with := r.PathValue("name")
+	msgs, err := data_access.GetConversation(r.Context(), username, with, before, limit)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve messages"})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, dmView(m))
+	}
+	resp := map[string]interface{}{"with": with, "messages": out}
+	if len(msgs) == limit {
+		resp["next"] = msgs[len(msgs)-1].ID
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// SendDirectMessageHandler sends {"message": "..."} to {name}, subject to
+// the chat flood limits and the sender's mutes and bans. The message is
+// pushed to every open connection of the recipient, and of the sender so
+// their other tabs stay in step.
+func SendDirectMessageHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+
+	// Direct messages share the user's chat allowance (see FloodGuard), which
+	// is only charged once the message is known to be deliverable.
+	m, err := business_logic.SendDirectMessage(username, r.PathValue("name"), req.Message, func() error {
+		return ChatFlood.Check(username, nil)
+	})
+	var throttled *throttleError
+	if errors.As(err, &throttled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.retryAfter.Seconds()))))
+		jsonResponse(w, http.StatusTooManyRequests, throttled.message())
+		return
+	} else if errors.Is(err, business_logic.ErrNoSuchUser) {
+		jsonResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	} else if errors.Is(err, business_logic.ErrChatMuted) || errors.Is(err, business_logic.ErrChatBanned) {
+		jsonResponse(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	view := dmView(m)
+	delivery := map[string]interface{}{"type": "dm", "message": view}
+	if unread, err := data_access.CountUnread(r.Context(), m.To); err == nil {
+		delivery["unread"] = unread
+	}
+	NotifyUser(m.To, delivery)
+	NotifyUser(m.From, map[string]interface{}{"type": "dm", "message": view})
+	jsonResponse(w, http.StatusCreated, view)
+}
+
+// MarkConversationReadHandler marks the caller's messages from {name} as
+// read and tells the caller's connections the new unread total.
+func MarkConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	with := r.PathValue("name")
+	n, err := data_access.MarkConversationRead(r.Context(), username, with)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not update messages"})
+		return
+	}
+	unread, err := data_access.CountUnread(r.Context(), username)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not count messages"})
+		return
+	}
+	if n > 0 {
+		NotifyUser(username, map[string]interface{}{"type": "dmRead", "with": with, "unread": unread})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"marked": n, "unread": unread})
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"othello/business_logic"
+)
+
+// FloodGuard enforces the chat flood limits (business_logic.ChatLimits) on
+// every chat action, over /ws/chat and the game sockets alike, and on direct
+// messages. Its state is kept per user, so reconnecting neither refills a
+// user's bucket nor lifts a mute.
+type FloodGuard struct {
+	mu     sync.Mutex
+	limits business_logic.ChatLimits
+	users  map[string]*floodState
+	checks int // Check calls since the last sweep
+}
+
+// floodState is what the guard knows about one user.
+type floodState struct {
+	bucket     business_logic.TokenBucket
+	lastSeen   time.Time   // last chat action
+	strikes    []time.Time // throttled actions within the strike window
+	mutes      int         // mutes in a row; sets the next mute's length
+	mutedUntil time.Time
+}
+
+// ChatFlood is the single global instance used by the server.
+var ChatFlood = &FloodGuard{
+	limits: business_logic.DefaultChatLimits,
+	users:  make(map[string]*floodState),
+}
+
+// floodSweepEvery is how many checks pass between sweeps of users the guard
+// can forget.
+const floodSweepEvery = 1000
+
+// SetLimits replaces the guard's limits.
+func (g *FloodGuard) SetLimits(limits business_logic.ChatLimits) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limits = limits
+}
+
+// throttleError explains why a chat action was refused and when the user may
+// try again.
+type throttleError struct {
+	muted      bool
+	retryAfter time.Duration
+}
+
+func (e *throttleError) Error() string {
+	wait := time.Duration(math.Ceil(e.retryAfter.Seconds())) * time.Second
+	if e.muted {
+		return fmt.Sprintf("you are muted for flooding the chat; you can post again in %v", wait)
+	}
+	return fmt.Sprintf("you are sending messages too fast; wait %v", wait)
+}
+
+// message is the error frame sent to the client, with the wait in seconds.
+func (e *throttleError) message() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "error",
+		"error":      e.Error(),
+		"throttled":  true,
+		"muted":      e.muted,
+		"retryAfter": math.Ceil(e.retryAfter.Seconds()),
+	}
+}
+
+// isChatAction reports whether a frame type posts, edits or deletes a chat
+// message, the actions the flood limits apply to.
+func isChatAction(frameType string) bool {
+	return frameType == "chat" || frameType == "chatEdit" || frameType == "chatDelete"
+}
+
+// Check charges one chat action to username and to the connection's bucket;
+// conn is nil for an action not sent over a socket, such as a direct
+// message. It returns a *throttleError if the action must be refused, in
+// which case neither bucket is charged.
+func (g *FloodGuard) Check(username string, conn *business_logic.TokenBucket) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	g.sweep(now)
+
+	u, ok := g.users[username]
+	if !ok {
+		u = &floodState{}
+		g.users[username] = u
+	}
+	if now.Before(u.mutedUntil) {
+		return &throttleError{muted: true, retryAfter: u.mutedUntil.Sub(now)}
+	}
+	if u.mutes > 0 && now.Sub(u.mutedUntil) > g.limits.MuteForget {
+		u.mutes = 0
+	}
+	u.lastSeen = now
+
+	// Only charge the buckets if both allow the action, so a throttled
+	// connection does not use up the user's allowance on their others.
+	var waitConn time.Duration
+	if conn != nil {
+		waitConn = conn.Wait(now, g.limits.ConnRate, g.limits.ConnBurst)
+	}
+	waitUser := u.bucket.Wait(now, g.limits.UserRate, g.limits.UserBurst)
+	if waitConn == 0 && waitUser == 0 {
+		if conn != nil {
+			conn.Take(now, g.limits.ConnRate, g.limits.ConnBurst)
+		}
+		u.bucket.Take(now, g.limits.UserRate, g.limits.UserBurst)
+		return nil
+	}
+
+	// A strike. Enough of them in the window earn a mute.
+	cutoff := now.Add(-g.limits.StrikeWindow)
+	for len(u.strikes) > 0 && u.strikes[0].Before(cutoff) {
+		u.strikes = u.strikes[1:]
+	}
+	u.strikes = append(u.strikes, now)
+	if len(u.strikes) >= g.limits.Strikes {
+		d := g.limits.MuteDuration(u.mutes)
+		u.mutes++
+		u.mutedUntil = now.Add(d)
+		u.strikes = nil
+		return &throttleError{muted: true, retryAfter: d}
+	}
+	return &throttleError{retryAfter: max(waitConn, waitUser)}
+}
+
+// sweep forgets, every floodSweepEvery checks, the users whose state no
+// longer matters: idle long enough for their bucket to be full again, with
+// no recent strikes and no mute to escalate. The caller holds mu.
+func (g *FloodGuard) sweep(now time.Time) {
+	g.checks++
+	if g.checks < floodSweepEvery {
+		return
+	}
+	g.checks = 0
+	refill := time.Duration(float64(g.limits.UserBurst) / g.limits.UserRate * float64(time.Second))
+	for username, u := range g.users {
+		idle := now.Sub(u.lastSeen) > max(refill, g.limits.StrikeWindow)
+		if idle && (u.mutes == 0 || now.Sub(u.mutedUntil) > g.limits.MuteForget) {
+			delete(g.users, username)
+		}
+	}
+}
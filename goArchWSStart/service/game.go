@@ -1,27 +1,269 @@
 package service
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"othello/business_logic"
 	"othello/data_access"
 )
 
+// gameState is the JSON view of a game sent to clients. The rules engine in
+// business_logic decides what is legal; the browser only sends intents.
+func gameState(g data_access.Game) map[string]interface{} {
+	state := map[string]interface{}{
+		"gameId":       g.ID,
+		"black":        g.Black,
+		"white":        g.White,
+		"status":       g.Status,
+		"board":        g.Board,
+		"toMove":       g.ToMove,
+		"timeControl":  g.TimeControl,
+		"rated":        g.Rated,
+		"imported":     g.Imported,
+		"result":       g.Result,
+		"reason":       g.ResultReason,
+		"moveCount":    len(g.Moves),
+		"drawOffer":    g.DrawOffer,
+		"rematchOffer": g.RematchOffer,
+	}
+	if g.RematchID != 0 {
+		state["rematchId"] = g.RematchID
+	}
+	if p, err := business_logic.GamePosition(g); err == nil {
+		black, white := p.Board.Count()
+		state["legalMoves"] = business_logic.SquareNames(p.LegalMoves())
+		state["blackCount"] = black
+		state["whiteCount"] = white
+	}
+	if clock, ok := business_logic.GameClock(g, time.Now()); ok {
+		tc, _ := business_logic.ParseTimeControl(g.TimeControl)
+		state["clock"] = map[string]interface{}{
+			"black":     clock.Black.Milliseconds(),
+			"white":     clock.White.Milliseconds(),
+			"running":   clock.Running,
+			"mode":      tc.Mode(),
+			"increment": tc.Increment.Milliseconds(),
+			"delay":     tc.Delay.Milliseconds(),
+		}
+	}
+	return state
+}
+
+// gameErrorStatus maps game errors to HTTP status codes.
+func gameErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, data_access.ErrGameNotFound), errors.Is(err, business_logic.ErrBadPly):
+		return http.StatusNotFound
+	case errors.Is(err, business_logic.ErrNotSeated):
+		return http.StatusForbidden
+	case errors.Is(err, business_logic.ErrGameOver), errors.Is(err, business_logic.ErrGameNotStarted),
+		errors.Is(err, business_logic.ErrFlagFell), errors.Is(err, business_logic.ErrActionNotAllowed),
+		errors.Is(err, business_logic.ErrNoOffer):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// gameIDParam reads the game ID from the {id} path segment or the ?game= query parameter.
+func gameIDParam(r *http.Request) (int64, error) {
+	raw := r.PathValue("id")
+	if raw == "" {
+		raw = r.URL.Query().Get("game")
+	}
+	if raw == "" {
+		return 0, errors.New("game id is required")
+	}
+	return strconv.ParseInt(raw, 10, 64)
+}
+
 func GetTurnHandler(w http.ResponseWriter, r *http.Request) {
-	// Service orchestrates: fetch current turn from data access
-	turn := data_access.GetTurn()
-	jsonResponse(w, http.StatusOK, map[string]string{"currentTurn": turn})
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Service orchestrates: make sure the game is live, then fetch the turn from data access
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	turn, err := data_access.GetTurn(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	state := gameState(g)
+	state["currentTurn"] = turn
+	jsonResponse(w, http.StatusOK, state)
 }
 
+// NextTurnHandler plays ?move=<square> in ?game=<id> for the signed-in user.
+// The move is validated by the rules engine before it is applied.
 func NextTurnHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	move := r.URL.Query().Get("move")
+	if move == "" {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "move is required"})
+		return
+	}
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+
 	// Service orchestrates: validate business rules, then update data
-	if err := business_logic.ValidateTurnTransition(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	g, res, err := business_logic.PlayGameMove(id, username, move)
+	if err != nil {
+		if errors.Is(err, business_logic.ErrFlagFell) {
+			notifyGameUpdate(g, nil)
+		}
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
 		return
 	}
 
-	next := data_access.NextTurn()
-	jsonResponse(w, http.StatusOK, map[string]string{"nextTurn": next})
+	notifyGameUpdate(g, &res)
+
+	state := gameState(g)
+	state["nextTurn"] = g.PlayerFor(g.ToMove)
+	state["flipped"] = business_logic.SquareNames(res.Flipped)
+	state["passed"] = res.Passed
+	jsonResponse(w, http.StatusOK, state)
+}
+
+// CreateGameHandler opens a new game with the caller seated as black.
+// An optional ?timeControl= (e.g. "5+3") sets the clock. These ad-hoc
+// games are unrated.
+func CreateGameHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	g, err := business_logic.NewGame(username, "", r.URL.Query().Get("timeControl"), false)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	jsonResponse(w, http.StatusCreated, gameState(g))
+}
+
+// JoinGameHandler seats the caller in the open seat of a waiting game.
+func JoinGameHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	if _, err := business_logic.LoadGame(id); err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	g, err := data_access.SeatPlayer(id, username)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	notifyGameUpdate(g, nil)
+	jsonResponse(w, http.StatusOK, gameState(g))
+}
+
+// GetGameHandler returns the current state of a game.
+func GetGameHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	state := gameState(g)
+	state["moves"] = moveList(g.Moves)
+	jsonResponse(w, http.StatusOK, state)
+}
+
+// moveList converts stored moves to their JSON form.
+func moveList(moves []data_access.Move) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(moves))
+	for _, m := range moves {
+		out = append(out, map[string]interface{}{
+			"ply":    m.Ply,
+			"color":  m.Color,
+			"square": m.Square,
+			"time":   m.PlayedAt.Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+// ListUserGamesHandler returns the games a user has played, newest first.
+func ListUserGamesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if v, err := strconv.Atoi(q); err == nil && v > 0 && v <= 200 {
+			limit = v
+		}
+	}
+
+	list, err := data_access.ListUserGames(r.Context(), r.PathValue("name"), limit)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve games"})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, g := range list {
+		entry := map[string]interface{}{
+			"gameId":      g.ID,
+			"black":       g.Black,
+			"white":       g.White,
+			"timeControl": g.TimeControl,
+			"rated":       g.Rated,
+			"status":      g.Status,
+			"result":      g.Result,
+			"created":     g.CreatedAt.Format(time.RFC3339),
+		}
+		if !g.FinishedAt.IsZero() {
+			entry["finished"] = g.FinishedAt.Format(time.RFC3339)
+		}
+		out = append(out, entry)
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"games": out})
+}
+
+// LiveGamesHandler lists the games in progress with how many people are
+// watching each, for the lobby.
+func LiveGamesHandler(w http.ResponseWriter, r *http.Request) {
+	list := data_access.ListActiveGames()
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, g := range list {
+		out = append(out, map[string]interface{}{
+			"gameId":      g.ID,
+			"black":       g.Black,
+			"white":       g.White,
+			"timeControl": g.TimeControl,
+			"rated":       g.Rated,
+			"spectators":  liveSpectators(g.ID),
+			"created":     g.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"games": out})
 }
 
 func BoardHandler(w http.ResponseWriter, r *http.Request) {
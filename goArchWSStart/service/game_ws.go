@@ -0,0 +1,662 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+
+	"github.com/gorilla/websocket"
+)
+
+// GameCommand is a message sent by a client over a game WebSocket.
+// The client only states its intent; the hub decides whether it is legal.
+// Type is "move", or one of the game actions: "resign", "abort",
+// "offerDraw", "acceptDraw", "declineDraw", "rematch", "declineRematch",
+// or "chat". Spectators may only send "chat", which only other spectators
+// see; the players' "chat" goes to the game's chat room, and they may also
+// "chatEdit" and "chatDelete" their messages there. In the enveloped
+// protocol the envelope carries Type.
+type GameCommand struct {
+	Type      string `json:"type"`
+	Square    string `json:"square,omitempty"` // algebraic square for "move", e.g. "f5"
+	Text      string `json:"text,omitempty"`   // message for "chat" and "chatEdit"
+	MessageID int64  `json:"id,omitempty"`     // chat message for "chatEdit" and "chatDelete"
+}
+
+// gameClient is one WebSocket connection watching or playing a game.
+// username comes from the session cookie of the upgrade request, and the
+// seat that username holds in the game decides which color it may play.
+// A connection from someone without a seat is a read-only spectator.
+type gameClient struct {
+	conn      *websocket.Conn
+	username  string
+	spectator bool
+	version   int
+	flood     business_logic.TokenBucket // the connection's chat rate limit, used by the Run loop
+}
+
+// send writes a message to the client in its protocol version; id is the
+// client frame it answers, if any. Only the hub's Run loop may call it.
+func (c *gameClient) send(id string, msg interface{}) error {
+	return writeFrame(c.conn, c.version, id, msg)
+}
+
+// Game chat history kept for new connections.
+const (
+	spectatorHistoryLength = 50  // messages replayed to a new spectator
+	playerHistoryLength    = 100 // chat room messages replayed to a version 0 player
+)
+
+// gameCommand pairs a command with the connection that sent it and the ID
+// of the frame it came in, if the client gave one. err is set instead of cmd
+// when the frame could not be read as a command.
+type gameCommand struct {
+	client *gameClient
+	cmd    GameCommand
+	id     string
+	err    error
+}
+
+// gameUpdate is a state change made outside the hub (e.g. via /next or a
+// player joining) that the hub should broadcast. move is nil when the change
+// was not a move.
+type gameUpdate struct {
+	game data_access.Game
+	move *business_logic.MoveResult
+}
+
+// GameHub coordinates one game's WebSocket connections, mirroring ChatHub.
+//
+// Concurrency model:
+// - clients: connections for this game (players and spectators), guarded by mu
+// - register/unregister: channels to add/remove clients (serialized by Run loop)
+// - commands: move intents from clients, applied one at a time by the Run loop
+// - updates: changes made elsewhere that need broadcasting
+// - roomChat: the game chat room's messages posted over /ws/chat, for the players
+// - notices: messages for one user's connections here, e.g. direct messages
+// - done: closed when the hub shuts down after its last client leaves
+// - spectatorChat: recent spectator messages, only touched by the Run loop
+//
+// All writes to client connections happen in the Run loop, so a connection is
+// never written by two goroutines at once.
+type GameHub struct {
+	gameID     int64
+	clients    map[*gameClient]bool
+	register   chan *gameClient
+	unregister chan *gameClient
+	commands   chan gameCommand
+	updates    chan gameUpdate
+	roomChat   chan interface{}
+	notices    chan directMessage
+	done       chan struct{}
+	mu         sync.RWMutex
+
+	spectatorChat []map[string]interface{}
+}
+
+// gameHubs holds the running hub for each game that has connections.
+var (
+	gameHubsMu sync.Mutex
+	gameHubs   = make(map[int64]*GameHub)
+)
+
+// getGameHub returns the hub for a game, starting one if needed.
+func getGameHub(gameID int64) *GameHub {
+	gameHubsMu.Lock()
+	defer gameHubsMu.Unlock()
+	if h, ok := gameHubs[gameID]; ok {
+		return h
+	}
+	h := &GameHub{
+		gameID:     gameID,
+		clients:    make(map[*gameClient]bool),
+		register:   make(chan *gameClient),
+		unregister: make(chan *gameClient),
+		commands:   make(chan gameCommand),
+		updates:    make(chan gameUpdate),
+		roomChat:   make(chan interface{}),
+		notices:    make(chan directMessage),
+		done:       make(chan struct{}),
+	}
+	gameHubs[gameID] = h
+	go h.Run()
+	return h
+}
+
+// notifyGameUpdate tells a game's hub (if any clients are connected) about a
+// change made outside the hub, such as a move played through /next. It also
+// re-arms the game's flag timer, since every such change may start or stop a
+// clock, and lets a computer opponent reply.
+func notifyGameUpdate(g data_access.Game, res *business_logic.MoveResult) {
+	armFlagTimer(g)
+	scheduleComputerMove(g)
+
+	gameHubsMu.Lock()
+	h, ok := gameHubs[g.ID]
+	gameHubsMu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case h.updates <- gameUpdate{game: g, move: res}:
+	case <-h.done:
+	}
+}
+
+// forwardGameChat hands a game chat room message to the game's hub, if any
+// clients are connected, for the players there.
+func forwardGameChat(gameID int64, msg interface{}) {
+	gameHubsMu.Lock()
+	h, ok := gameHubs[gameID]
+	gameHubsMu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case h.roomChat <- msg:
+	case <-h.done:
+	}
+}
+
+// notifyGameSockets hands a message for one user to every game hub, for
+// that user's connections there (see NotifyUser).
+func notifyGameSockets(username string, msg interface{}) {
+	gameHubsMu.Lock()
+	hubs := make([]*GameHub, 0, len(gameHubs))
+	for _, h := range gameHubs {
+		hubs = append(hubs, h)
+	}
+	gameHubsMu.Unlock()
+	for _, h := range hubs {
+		select {
+		case h.notices <- directMessage{to: username, msg: msg}:
+		case <-h.done:
+		}
+	}
+}
+
+// Run is the event loop for one game. It exits once the last client has left.
+func (h *GameHub) Run() {
+	for {
+		select {
+
+		// A player or spectator connected: send them the full current state.
+		case client := <-h.register:
+			h.mu.Lock()
+			h.clients[client] = true
+			h.mu.Unlock()
+
+			g, err := business_logic.LoadGame(h.gameID)
+			if err != nil {
+				h.sendError(client, "", err.Error())
+				continue
+			}
+			// After a restart nothing is timing a reloaded game, or thinking
+			// for its computer player, until someone opens it.
+			armFlagTimer(g)
+			scheduleComputerMove(g)
+			state := gameState(g)
+			state["type"] = "state"
+			state["you"] = g.ColorOf(client.username)
+			state["spectators"] = h.spectatorCount()
+			if err := client.send("", state); err != nil {
+				log.Printf("Error sending game state: %v", err)
+			}
+			if client.spectator {
+				for _, msg := range h.spectatorChat {
+					if err := client.send("", msg); err != nil {
+						log.Printf("Error sending spectator chat history: %v", err)
+					}
+				}
+				h.broadcastSpectators()
+			} else if client.version == 0 {
+				// Newer clients page through /api/chat/history instead.
+				for _, msg := range Hub.history(gameRoom(h.gameID), playerHistoryLength) {
+					if err := client.send("", msg); err != nil {
+						log.Printf("Error sending game chat history: %v", err)
+					}
+				}
+			}
+
+		// A client disconnected. Shut the hub down if nobody is left.
+		case client := <-h.unregister:
+			h.mu.Lock()
+			if _, ok := h.clients[client]; ok {
+				delete(h.clients, client)
+				client.conn.Close()
+			}
+			empty := len(h.clients) == 0
+			h.mu.Unlock()
+			if client.spectator && !empty {
+				h.broadcastSpectators()
+			}
+
+			if empty {
+				gameHubsMu.Lock()
+				if gameHubs[h.gameID] == h {
+					delete(gameHubs, h.gameID)
+				}
+				gameHubsMu.Unlock()
+				close(h.done)
+				return
+			}
+
+		// A client asked to play a move. The rules engine validates it against
+		// the seat the client's user holds; errors go back to the sender only,
+		// and a command that worked is acked.
+		// Spectators are read-only apart from their own chat.
+		case c := <-h.commands:
+			switch {
+			case c.err != nil:
+				h.sendError(c.client, c.id, c.err.Error())
+			case isChatAction(c.cmd.Type) && h.throttled(c):
+			case c.cmd.Type == "chat" && c.client.spectator:
+				h.spectatorSay(c)
+			case c.cmd.Type == "chat":
+				h.playerSay(c)
+			case c.cmd.Type == "chatEdit" || c.cmd.Type == "chatDelete":
+				h.playerEdit(c)
+			case c.client.spectator:
+				h.sendError(c.client, c.id, "spectators cannot play or act in the game")
+			case c.cmd.Type == "move":
+				g, res, err := business_logic.PlayGameMove(h.gameID, c.client.username, c.cmd.Square)
+				if errors.Is(err, business_logic.ErrFlagFell) {
+					armFlagTimer(g)
+					h.broadcastState(g)
+					h.sendError(c.client, c.id, err.Error())
+					continue
+				} else if err != nil {
+					h.sendError(c.client, c.id, err.Error())
+					continue
+				}
+				armFlagTimer(g)
+				scheduleComputerMove(g)
+				h.broadcastMove(g, res)
+				h.ack(c)
+			default:
+				h.handleAction(c)
+			}
+
+		case msg := <-h.roomChat:
+			h.sendPlayers(msg)
+
+		case n := <-h.notices:
+			h.sendUser(n.to, n.msg)
+
+		case u := <-h.updates:
+			if u.move != nil {
+				h.broadcastMove(u.game, *u.move)
+				continue
+			}
+			h.broadcastState(u.game)
+		}
+	}
+}
+
+// spectatorCount returns how many connections are watching without a seat.
+func (h *GameHub) spectatorCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for client := range h.clients {
+		if client.spectator {
+			n++
+		}
+	}
+	return n
+}
+
+// broadcastSpectators tells everyone how many people are watching.
+func (h *GameHub) broadcastSpectators() {
+	h.broadcast(map[string]interface{}{"type": "spectators", "count": h.spectatorCount()})
+}
+
+// chatText checks the text of a chat command (see
+// business_logic.CleanChatMessage) and that its sender may post. ok is false
+// if the command was answered here: an empty message is acked and ignored,
+// an invalid one or one from a muted or banned user rejected.
+func (h *GameHub) chatText(c gameCommand) (text string, ok bool) {
+	if strings.TrimSpace(c.cmd.Text) == "" {
+		h.ack(c)
+		return "", false
+	}
+	if c.client.username == "" {
+		h.sendError(c.client, c.id, "sign in to chat")
+		return "", false
+	}
+	if err := business_logic.CanPostChat(c.client.username); err != nil {
+		h.sendError(c.client, c.id, err.Error())
+		return "", false
+	}
+	text, err := business_logic.CleanChatMessage(c.cmd.Text)
+	if err != nil {
+		h.sendError(c.client, c.id, err.Error())
+		return "", false
+	}
+	return text, true
+}
+
+// spectatorSay relays a spectator's chat message to the other spectators.
+// Players never receive it, so nobody can kibitz to them.
+func (h *GameHub) spectatorSay(c gameCommand) {
+	text, ok := h.chatText(c)
+	if !ok {
+		return
+	}
+	msg := map[string]interface{}{
+		"type":     "spectatorChat",
+		"username": c.client.username,
+		"text":     text,
+		"tokens":   chatTokens(text),
+		"time":     time.Now().UTC().Format(time.RFC3339),
+	}
+	h.spectatorChat = append(h.spectatorChat, msg)
+	if n := len(h.spectatorChat); n > spectatorHistoryLength {
+		h.spectatorChat = h.spectatorChat[n-spectatorHistoryLength:]
+	}
+
+	h.mu.Lock()
+	for client := range h.clients {
+		if !client.spectator {
+			continue
+		}
+		if err := client.send("", msg); err != nil {
+			log.Printf("Error sending spectator chat: %v", err)
+			client.conn.Close()
+		}
+	}
+	h.mu.Unlock()
+	h.ack(c)
+}
+
+// throttled applies the chat flood limits (ChatFlood) to a chat command. It
+// reports whether the command was refused, in which case the sender has been
+// told why.
+func (h *GameHub) throttled(c gameCommand) bool {
+	var throttled *throttleError
+	if err := ChatFlood.Check(c.client.username, &c.client.flood); errors.As(err, &throttled) {
+		if err := c.client.send(c.id, throttled.message()); err != nil {
+			log.Printf("Error sending game error: %v", err)
+		}
+		return true
+	}
+	return false
+}
+
+// playerSay posts a player's message to the game's chat room.
+func (h *GameHub) playerSay(c gameCommand) {
+	text, ok := h.chatText(c)
+	if !ok {
+		return
+	}
+	m, err := business_logic.PostChatMessage(gameRoom(h.gameID), "", c.client.username, text)
+	if err != nil {
+		h.sendError(c.client, c.id, err.Error())
+		return
+	}
+	h.publishChat(chatView(m))
+	h.ack(c)
+}
+
+// playerEdit changes or deletes one of a player's messages in the game's
+// chat room.
+func (h *GameHub) playerEdit(c gameCommand) {
+	room := gameRoom(h.gameID)
+	if c.cmd.Type == "chatDelete" {
+		if err := business_logic.DeleteChatMessage(room, c.cmd.MessageID, c.client.username); err != nil {
+			h.sendError(c.client, c.id, err.Error())
+			return
+		}
+		h.publishChat(map[string]interface{}{"type": "chatDeleted", "id": c.cmd.MessageID, "room": room})
+		h.ack(c)
+		return
+	}
+
+	m, err := business_logic.EditChatMessage(room, c.cmd.MessageID, c.client.username, c.cmd.Text)
+	if err != nil {
+		h.sendError(c.client, c.id, err.Error())
+		return
+	}
+	h.publishChat(map[string]interface{}{"type": "chatEdited", "message": chatView(m)})
+	h.ack(c)
+}
+
+// publishChat is publishChat for the hub's own game room: the message goes
+// to players chatting over /ws/chat through Hub and to the players here.
+// Spectators never receive it.
+func (h *GameHub) publishChat(msg interface{}) {
+	Hub.broadcast <- roomMessage{room: gameRoom(h.gameID), msg: msg}
+	h.sendPlayers(msg)
+}
+
+// sendPlayers writes a message to the players' connections only.
+func (h *GameHub) sendPlayers(msg interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.spectator {
+			continue
+		}
+		if err := client.send("", msg); err != nil {
+			log.Printf("Error sending game chat: %v", err)
+			client.conn.Close()
+		}
+	}
+}
+
+// sendUser sends a message to one user's connections to this game.
+func (h *GameHub) sendUser(username string, msg interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.username != username {
+			continue
+		}
+		if err := client.send("", msg); err != nil {
+			log.Printf("Error sending notification: %v", err)
+			client.conn.Close()
+		}
+	}
+}
+
+// liveSpectators returns the spectator count of a game's hub, or 0 when
+// nobody has the game open.
+func liveSpectators(gameID int64) int {
+	gameHubsMu.Lock()
+	h, ok := gameHubs[gameID]
+	gameHubsMu.Unlock()
+	if !ok {
+		return 0
+	}
+	return h.spectatorCount()
+}
+
+// handleAction applies a resign/abort/draw/rematch command. The resulting
+// state goes to everyone with "action" and "by" set, so clients can say what
+// happened; a rematch also tells everyone the new game's ID.
+func (h *GameHub) handleAction(c gameCommand) {
+	var g data_access.Game
+	var rematch *data_access.Game
+	var err error
+	username := c.client.username
+	switch c.cmd.Type {
+	case "resign":
+		g, err = business_logic.ResignGame(h.gameID, username)
+	case "abort":
+		g, err = business_logic.AbortGame(h.gameID, username)
+	case "offerDraw":
+		g, _, err = business_logic.OfferDraw(h.gameID, username)
+	case "acceptDraw", "declineDraw":
+		g, err = business_logic.AnswerDraw(h.gameID, username, c.cmd.Type == "acceptDraw")
+	case "rematch":
+		g, rematch, err = business_logic.OfferRematch(h.gameID, username)
+	case "declineRematch":
+		g, err = business_logic.DeclineRematch(h.gameID, username)
+	default:
+		h.sendError(c.client, c.id, "unknown command "+c.cmd.Type)
+		return
+	}
+	if err != nil {
+		h.sendError(c.client, c.id, err.Error())
+		return
+	}
+
+	armFlagTimer(g)
+	h.broadcastAction(g, c.cmd.Type, g.ColorOf(username), rematch)
+	h.ack(c)
+
+	if answer, ok := computerResponds(g, c.cmd.Type); ok {
+		h.broadcastAction(answer.game, answer.action, answer.by, answer.rematch)
+	}
+}
+
+// broadcastAction sends the state after a game action, plus the new game's
+// ID when the action started a rematch.
+func (h *GameHub) broadcastAction(g data_access.Game, action, by string, rematch *data_access.Game) {
+	Online.Refresh(g.Black, g.White)
+	state := gameState(g)
+	state["type"] = "state"
+	state["action"] = action
+	state["by"] = by
+	h.broadcast(state)
+	if rematch != nil {
+		h.broadcast(map[string]interface{}{"type": "rematch", "gameId": rematch.ID})
+	}
+}
+
+// broadcastState sends the full game state to every connection, e.g. after
+// a player joined or a flag fell. Both are presence changes for the players.
+func (h *GameHub) broadcastState(g data_access.Game) {
+	Online.Refresh(g.Black, g.White)
+	state := gameState(g)
+	state["type"] = "state"
+	h.broadcast(state)
+}
+
+// broadcastMove sends the new board, the flipped discs and the side to move
+// to every connection watching the game.
+func (h *GameHub) broadcastMove(g data_access.Game, res business_logic.MoveResult) {
+	state := gameState(g)
+	state["type"] = "move"
+	state["color"] = res.Color.String()
+	state["square"] = business_logic.SquareName(res.Square)
+	state["flipped"] = business_logic.SquareNames(res.Flipped)
+	state["passed"] = res.Passed
+	state["gameOver"] = res.GameOver
+	h.broadcast(state)
+	if res.GameOver {
+		Online.Refresh(g.Black, g.White)
+	}
+}
+
+// broadcast writes a message to every client. If a write fails the client
+// is dropped; its read loop will notice the closed connection and unregister.
+func (h *GameHub) broadcast(msg interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if err := client.send("", msg); err != nil {
+			log.Printf("Error broadcasting game update: %v", err)
+			client.conn.Close()
+		}
+	}
+}
+
+// sendError tells one client its command failed; id is the frame that
+// carried the command, if any.
+func (h *GameHub) sendError(client *gameClient, id, message string) {
+	if err := client.send(id, errorMessage(message)); err != nil {
+		log.Printf("Error sending game error: %v", err)
+	}
+}
+
+// ack confirms to its sender that a command was handled.
+func (h *GameHub) ack(c gameCommand) {
+	if err := c.client.send(c.id, ackMessage); err != nil {
+		log.Printf("Error sending ack: %v", err)
+	}
+}
+
+// GameHandler upgrades /ws/game/{id} to a WebSocket and pumps the client's
+// commands into that game's hub.
+// Lifecycle:
+//  1. Check the game exists and resolve the session user; users without a
+//     seat connect as spectators
+//  2. Upgrade to WebSocket; ?v= picks the protocol version (see protocol.go)
+//  3. Register with the game's hub (triggers a full state message)
+//  4. Loop reading command frames and forward them to the hub
+//  5. On error/close, unregister
+//
+// The connection also counts towards the user's presence, and a player's
+// towards them being in a game.
+func GameHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	username, _ := sessionUsername(r)
+	version, err := protocolVersion(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	// Taking an open seat goes through /api/games/{id}/join, after which the
+	// page reconnects; so anyone without a seat now is watching.
+	client := &gameClient{conn: conn, username: username, spectator: g.ColorOf(username) == "", version: version}
+
+	// The hub may be shutting down between lookup and register; if so,
+	// look it up again (a fresh one is started).
+	var hub *GameHub
+	for registered := false; !registered; {
+		hub = getGameHub(id)
+		select {
+		case hub.register <- client:
+			registered = true
+		case <-hub.done:
+		}
+	}
+	// Only a player's socket counts towards being in a game.
+	var seat int64
+	if !client.spectator {
+		seat = id
+	}
+	Online.Connected(username, seat)
+	defer func() {
+		hub.unregister <- client
+		Online.Disconnected(username, seat)
+	}()
+
+	for {
+		env, err := readFrame(conn, version)
+		if err != nil && !errors.Is(err, errBadFrame) {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+		c := gameCommand{client: client, id: env.ID, err: err}
+		if err == nil {
+			c.err = decodePayload(env, &c.cmd)
+			c.cmd.Type = env.Type
+		}
+		hub.commands <- c
+	}
+}
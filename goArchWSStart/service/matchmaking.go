@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"othello/business_logic"
+)
+
+// matchInterval is how often the matchmaker tries to pair queued players.
+const matchInterval = time.Second
+
+// Matchmaker runs the "play now" queue.
+//
+// Concurrency model:
+// - queue: waiting players keyed by username, owned by the Run loop (no lock)
+// - join/leave: channels to add/remove players (serialized by Run loop)
+// - a ticker drives pairing rounds and drops players whose lobby socket closed
+//
+// The Run loop talks to players only through Hub.Notify and reports queue
+// changes to Online; neither calls back into the matchmaker, so the loops
+// cannot deadlock.
+type Matchmaker struct {
+	queue map[string]business_logic.QueueEntry
+	join  chan business_logic.QueueEntry
+	leave chan string
+}
+
+// Matchmaking is the single global matchmaker used by the server.
+var Matchmaking = &Matchmaker{
+	queue: make(map[string]business_logic.QueueEntry),
+	join:  make(chan business_logic.QueueEntry),
+	leave: make(chan string),
+}
+
+// Run is the matchmaker's event loop. Start it once from main, next to Hub.Run.
+func (m *Matchmaker) Run() {
+	ticker := time.NewTicker(matchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+
+		// A player joined (or changed their time control).
+		case e := <-m.join:
+			m.queue[e.Username] = e
+			Online.SetQueued(e.Username, true)
+			Hub.Notify(e.Username, map[string]interface{}{
+				"type":        "queueJoined",
+				"timeControl": e.TimeControl,
+				"rating":      e.Rating,
+			})
+
+		// A player left the queue on purpose.
+		case username := <-m.leave:
+			if _, ok := m.queue[username]; ok {
+				delete(m.queue, username)
+				Online.SetQueued(username, false)
+				Hub.Notify(username, map[string]string{"type": "queueLeft"})
+			}
+
+		case now := <-ticker.C:
+			// Players whose lobby sockets all closed are dropped instead of
+			// being matched into a game nobody will open.
+			entries := make([]business_logic.QueueEntry, 0, len(m.queue))
+			for username, e := range m.queue {
+				if !Hub.IsOnline(username) {
+					delete(m.queue, username)
+					Online.SetQueued(username, false)
+					continue
+				}
+				entries = append(entries, e)
+			}
+
+			for _, pair := range business_logic.PairQueue(entries, now) {
+				delete(m.queue, pair[0].Username)
+				delete(m.queue, pair[1].Username)
+				Online.SetQueued(pair[0].Username, false)
+				Online.SetQueued(pair[1].Username, false)
+				m.startGame(pair[0], pair[1])
+			}
+		}
+	}
+}
+
+// startGame creates the (rated) game for a matched pair with random colors
+// and sends both players a matchFound event pointing at it.
+func (m *Matchmaker) startGame(a, b business_logic.QueueEntry) {
+	if rand.IntN(2) == 1 {
+		a, b = b, a
+	}
+	g, err := business_logic.NewGame(a.Username, b.Username, a.TimeControl, true)
+	if err != nil {
+		log.Printf("matchmaker: could not create game for %s vs %s: %v", a.Username, b.Username, err)
+		for _, e := range []business_logic.QueueEntry{a, b} {
+			Hub.Notify(e.Username, map[string]string{"type": "error", "error": "could not start matched game"})
+		}
+		return
+	}
+	msg := map[string]interface{}{
+		"type":        "matchFound",
+		"gameId":      g.ID,
+		"black":       g.Black,
+		"white":       g.White,
+		"timeControl": g.TimeControl,
+	}
+	Hub.Notify(g.Black, msg)
+	Hub.Notify(g.White, msg)
+}
+
+// JoinQueueHandler puts the caller in the matchmaking queue. The body may
+// give a "timeControl" (e.g. "5+3"); only players with the same time control
+// are paired. The caller must have the lobby open to be matched.
+func JoinQueueHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	var req struct {
+		TimeControl string `json:"timeControl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	tc, err := business_logic.ParseTimeControl(req.TimeControl)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !Hub.IsOnline(username) {
+		jsonResponse(w, http.StatusConflict, map[string]string{"error": "open the lobby before joining the queue"})
+		return
+	}
+
+	e := business_logic.QueueEntry{
+		Username:    username,
+		TimeControl: tc.String(),
+		Rating:      business_logic.PlayerRating(username, tc.Category()),
+		JoinedAt:    time.Now(),
+	}
+	Matchmaking.join <- e
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"status": "queued", "timeControl": e.TimeControl})
+}
+
+// LeaveQueueHandler removes the caller from the matchmaking queue.
+func LeaveQueueHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	Matchmaking.leave <- username
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "left"})
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// moderationErrorStatus maps a moderation error to an HTTP status.
+func moderationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, business_logic.ErrNotModerator), errors.Is(err, errNotInRoom):
+		return http.StatusForbidden
+	case errors.Is(err, business_logic.ErrNoSuchUser),
+		errors.Is(err, data_access.ErrChatMessageNotFound),
+		errors.Is(err, data_access.ErrReportNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// moderator returns the session user if they are a moderator, and answers
+// the request otherwise.
+func moderator(w http.ResponseWriter, r *http.Request) (string, bool) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return "", false
+	}
+	if !business_logic.IsModerator(username) {
+		jsonResponse(w, http.StatusForbidden, map[string]string{"error": business_logic.ErrNotModerator.Error()})
+		return "", false
+	}
+	return username, true
+}
+
+// moderationRequest is the body of the moderation endpoints; which fields
+// count depends on the action.
+type moderationRequest struct {
+	Duration string `json:"duration"` // for mutes, e.g. "10m" or "24h"
+	Reason   string `json:"reason"`
+}
+
+// decodeModerationRequest reads an optional moderationRequest body.
+func decodeModerationRequest(w http.ResponseWriter, r *http.Request) (moderationRequest, bool) {
+	var req moderationRequest
+	if r.ContentLength == 0 {
+		return req, true
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return req, false
+	}
+	return req, true
+}
+
+// sanctionView is the JSON form of a mute or ban.
+func sanctionView(s data_access.ChatSanction) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":        s.ID,
+		"username":  s.Username,
+		"kind":      s.Kind,
+		"reason":    s.Reason,
+		"createdBy": s.CreatedBy,
+		"createdAt": s.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if !s.ExpiresAt.IsZero() {
+		v["expiresAt"] = s.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// reportView is the JSON form of a report.
+func reportView(rep data_access.ChatReport) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":           rep.ID,
+		"messageId":    rep.MessageID,
+		"room":         rep.Room,
+		"reporter":     rep.Reporter,
+		"reportedUser": rep.ReportedUser,
+		"message":      rep.Message,
+		"reason":       rep.Reason,
+		"createdAt":    rep.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if !rep.ResolvedAt.IsZero() {
+		v["resolvedAt"] = rep.ResolvedAt.UTC().Format(time.RFC3339)
+		v["resolvedBy"] = rep.ResolvedBy
+	}
+	return v
+}
+
+// MuteUserHandler mutes {name} for {"duration": "10m", "reason": "..."}.
+func MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	mod, ok := moderator(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid duration " + strconv.Quote(req.Duration)})
+		return
+	}
+	s, err := business_logic.MuteUser(mod, r.PathValue("name"), d, req.Reason)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	jsonResponse(w, http.StatusCreated, sanctionView(s))
+}
+
+// BanUserHandler bans {name} from chat until unbanned ({"reason": "..."}).
+func BanUserHandler(w http.ResponseWriter, r *http.Request) {
+	mod, ok := moderator(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+	s, err := business_logic.BanUser(mod, r.PathValue("name"), req.Reason)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	jsonResponse(w, http.StatusCreated, sanctionView(s))
+}
+
+// UnmuteUserHandler lifts {name}'s mutes.
+func UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	liftSanction(w, r, data_access.SanctionMute)
+}
+
+// UnbanUserHandler lifts {name}'s ban.
+func UnbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	liftSanction(w, r, data_access.SanctionBan)
+}
+
+func liftSanction(w http.ResponseWriter, r *http.Request, kind string) {
+	mod, ok := moderator(w, r)
+	if !ok {
+		return
+	}
+	if err := business_logic.LiftSanction(mod, r.PathValue("name"), kind); err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"status": "lifted"})
+}
+
+// ModeratorDeleteMessageHandler deletes any chat message ({id}) and records
+// {"reason": "..."} in the audit log. The message disappears for everyone in
+// its room.
+func ModeratorDeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	mod, ok := moderator(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid message id"})
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+	m, err := business_logic.ModeratorDeleteMessage(mod, id, req.Reason)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	publishChat(m.Room_ID, map[string]interface{}{"type": "chatDeleted", "id": m.Message_ID, "room": m.Room_ID})
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"deleted": m.Message_ID})
+}
+
+// ClearUserHistoryHandler deletes every chat message {name} wrote
+// ({"reason": "..."}). Each room they posted in is told which messages went.
+func ClearUserHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	mod, ok := moderator(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+	target := r.PathValue("name")
+	removed, err := business_logic.ClearUserHistory(mod, target, req.Reason)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	byRoom := make(map[string][]int64)
+	for _, m := range removed {
+		byRoom[m.Room_ID] = append(byRoom[m.Room_ID], m.Message_ID)
+	}
+	for room, ids := range byRoom {
+		publishChat(room, map[string]interface{}{"type": "chatCleared", "username": target, "room": room, "ids": ids})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"deleted": len(removed)})
+}
+
+// ReportMessageHandler reports chat message {id} to the moderators
+// ({"reason": "..."}). Anyone who can read the message's room may report it.
+func ReportMessageHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := sessionUsername(r)
+	if !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid message id"})
+		return
+	}
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	m, err := data_access.GetMessage(r.Context(), id)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	room, err := resolveChatRoom(m.Room_ID, username)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	rep, err := business_logic.ReportMessage(username, room, id, req.Reason)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]interface{}{"id": rep.ID})
+}
+
+// ListReportsHandler lists reports for moderators, newest first: the open
+// ones, or all with ?status=all. ?limit= is at most 100 (default 50).
+func ListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := moderator(w, r); !ok {
+		return
+	}
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if v, err := strconv.Atoi(q); err == nil && v > 0 && v <= 100 {
+			limit = v
+		}
+	}
+	reports, err := data_access.ListReports(r.Context(), r.URL.Query().Get("status") != "all", limit)
+	if err != nil {
+		log.Printf("moderation: listing reports failed: %v", err)
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve reports"})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(reports))
+	for _, rep := range reports {
+		out = append(out, reportView(rep))
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"reports": out})
+}
+
+// ResolveReportHandler closes report {id}.
+func ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	mod, ok := moderator(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid report id"})
+		return
+	}
+	rep, err := business_logic.ResolveReport(mod, id)
+	if err != nil {
+		jsonResponse(w, moderationErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	jsonResponse(w, http.StatusOK, reportView(rep))
+}
+
+// ModerationLogHandler returns the moderation audit log for moderators,
+// newest first. ?user= narrows it to actions on one user; ?before= takes the
+// "next" cursor of the previous page; ?limit= is at most 100 (default 50).
+func ModerationLogHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := moderator(w, r); !ok {
+		return
+	}
+	limit := 50
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if v, err := strconv.Atoi(q); err == nil && v > 0 && v <= 100 {
+			limit = v
+		}
+	}
+	before, err := historyCursor(r, "before")
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	entries, err := data_access.ListModerationLog(r.Context(), r.URL.Query().Get("user"), before, limit)
+	if err != nil {
+		log.Printf("moderation: reading the log failed: %v", err)
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve the moderation log"})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		v := map[string]interface{}{
+			"id":     e.ID,
+			"actor":  e.Actor,
+			"action": e.Action,
+			"target": e.Target,
+			"detail": e.Detail,
+			"time":   e.CreatedAt.UTC().Format(time.RFC3339),
+		}
+		if e.MessageID != 0 {
+			v["messageId"] = e.MessageID
+		}
+		out = append(out, v)
+	}
+	resp := map[string]interface{}{"entries": out}
+	if len(entries) == limit {
+		resp["next"] = entries[len(entries)-1].ID
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
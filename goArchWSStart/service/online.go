@@ -1,9 +1,11 @@
 package service
 
 import (
+	"cmp"
+	"slices"
 	"sync"
 
-	"github.com/gorilla/websocket"
+	"othello/data_access"
 )
 
 type User struct {
@@ -11,19 +13,170 @@ type User struct {
 	Username      string `json:"username,omitempty"`
 }
 
-// ChatHub coordinates all chat activity.
+// Presence statuses shown in the lobby's player list.
+const (
+	StatusIdle           = "idle"           // connected, not playing or queued
+	StatusInGame         = "inGame"         // has an active game open as a player
+	StatusLookingForGame = "lookingForGame" // in the "play now" queue
+	StatusOffline        = "offline"        // last connection closed
+)
+
+// presenceKind says what a presenceEvent reports.
+type presenceKind int
+
+const (
+	presenceConnect    presenceKind = iota // a socket opened
+	presenceDisconnect                     // a socket closed
+	presenceQueued                         // joined the matchmaking queue
+	presenceUnqueued                       // left it, or was matched
+	presenceRefresh                        // something else changed, e.g. a game ended
+)
+
+// presenceEvent is one change to a user's presence. gameID is set when a
+// player's game socket opens or closes.
+type presenceEvent struct {
+	username string
+	kind     presenceKind
+	gameID   int64
+}
+
+// userPresence is what the hub knows about one connected user.
+type userPresence struct {
+	conns  int           // open sockets of any kind
+	games  map[int64]int // open player sockets per game
+	queued bool
+	status string
+}
+
+// UserHub tracks who is online from their open WebSocket connections
+// (lobby, chat and game sockets alike) and what they are doing.
 //
 // Concurrency model:
-// - clients: set of active WebSocket connections (guarded by mu)
-// - register/unregister: channels to add/remove clients (serialized by Run loop)
-// - broadcast: channel to fan messages out to all connected clients
-// - messages: in-memory history; appended to on each broadcast (you'd replace with DB table)
-// - mu: protects both clients and messages across goroutines
+// - users: presence per username, written by the Run loop (guarded by mu)
+// - events: connects, disconnects and status changes, applied one at a time
+//
+// Changes go out to the lobby as "presence" events through Hub.Notify; a new
+// lobby connection gets the whole list from ChatHub (via Snapshot) instead.
+// ChatHub never sends to UserHub, so the two loops cannot deadlock; game hubs
+// and the matchmaker only ever send to it.
 type UserHub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan User
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	users      []User
-	mu         sync.RWMutex
+	users  map[string]*userPresence
+	events chan presenceEvent
+	mu     sync.RWMutex
+}
+
+// Online is the single global presence tracker used by the server.
+var Online = &UserHub{
+	users:  make(map[string]*userPresence),
+	events: make(chan presenceEvent),
+}
+
+// Connected records a newly opened socket. gameID is the game a player's
+// game socket belongs to, or 0.
+func (h *UserHub) Connected(username string, gameID int64) {
+	if username != "" {
+		h.events <- presenceEvent{username: username, kind: presenceConnect, gameID: gameID}
+	}
+}
+
+// Disconnected records a closed socket, mirroring Connected.
+func (h *UserHub) Disconnected(username string, gameID int64) {
+	if username != "" {
+		h.events <- presenceEvent{username: username, kind: presenceDisconnect, gameID: gameID}
+	}
+}
+
+// SetQueued records a user joining or leaving the matchmaking queue.
+func (h *UserHub) SetQueued(username string, queued bool) {
+	kind := presenceUnqueued
+	if queued {
+		kind = presenceQueued
+	}
+	h.events <- presenceEvent{username: username, kind: kind}
+}
+
+// Refresh re-derives the status of users, e.g. after their game ended.
+func (h *UserHub) Refresh(usernames ...string) {
+	for _, u := range usernames {
+		if u != "" {
+			h.events <- presenceEvent{username: u, kind: presenceRefresh}
+		}
+	}
+}
+
+// Snapshot returns everyone online with their status, sorted by name.
+func (h *UserHub) Snapshot() []map[string]string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]map[string]string, 0, len(h.users))
+	for name, p := range h.users {
+		out = append(out, map[string]string{"username": name, "status": p.status})
+	}
+	slices.SortFunc(out, func(a, b map[string]string) int {
+		return cmp.Compare(a["username"], b["username"])
+	})
+	return out
+}
+
+// Run is the presence event loop. Start it once from main, next to Hub.Run.
+func (h *UserHub) Run() {
+	for e := range h.events {
+		h.mu.Lock()
+		p, known := h.users[e.username]
+		if !known {
+			if e.kind != presenceConnect {
+				// Nothing to track for someone with no open sockets.
+				h.mu.Unlock()
+				continue
+			}
+			p = &userPresence{games: make(map[int64]int)}
+			h.users[e.username] = p
+		}
+
+		switch e.kind {
+		case presenceConnect:
+			p.conns++
+			if e.gameID != 0 {
+				p.games[e.gameID]++
+			}
+		case presenceDisconnect:
+			p.conns--
+			if e.gameID != 0 {
+				if p.games[e.gameID]--; p.games[e.gameID] <= 0 {
+					delete(p.games, e.gameID)
+				}
+			}
+		case presenceQueued:
+			p.queued = true
+		case presenceUnqueued:
+			p.queued = false
+		}
+
+		old := p.status
+		if p.conns <= 0 {
+			delete(h.users, e.username)
+			p.status = StatusOffline
+		} else {
+			p.status = presenceStatus(p)
+		}
+		h.mu.Unlock()
+
+		if p.status != old {
+			Hub.Notify("", map[string]string{"type": "presence", "username": e.username, "status": p.status})
+		}
+	}
+}
+
+// presenceStatus derives a connected user's status. Playing wins over
+// queueing: only games still in progress count.
+func presenceStatus(p *userPresence) string {
+	for id := range p.games {
+		if g, err := data_access.GetGame(id); err == nil && g.Status == data_access.GameActive {
+			return StatusInGame
+		}
+	}
+	if p.queued {
+		return StatusLookingForGame
+	}
+	return StatusIdle
 }
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+)
+
+// The WebSocket protocol, shared by the lobby socket (/ws/chat) and the game
+// sockets (/ws/game/{id}).
+//
+// Every frame is an envelope:
+//
+//	{"v": 1, "type": "chat", "id": "c42", "payload": {"message": "hi"}}
+//
+// v is the protocol version and type names the payload: "chat", "presence",
+// "challenge", "move", "state" and so on. id is optional and chosen by the
+// client; a client frame that carries one is answered with an "ack" frame,
+// or an "error" frame, with the same id once the server has handled it.
+//
+// A client picks its version when it connects, with ?v= on the socket URL.
+// Without it, it gets version 0: the original protocol of bare JSON objects
+// with a "type" field (chat messages have none) and no acks. Both versions
+// are written from the same messages, so older clients keep working while
+// the protocol evolves.
+
+// ProtocolVersion is the newest protocol version the server speaks.
+const ProtocolVersion = 1
+
+// Envelope is one frame of the protocol.
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// outEnvelope is an Envelope being written; the payload is encoded with it.
+type outEnvelope struct {
+	Version int         `json:"v"`
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// errBadFrame is returned for a frame that is valid JSON but not a valid
+// message. The connection stays open; the client is sent an error.
+var errBadFrame = errors.New("invalid frame")
+
+// sinceVersion is the protocol version that introduced a message type.
+// Clients speaking an older version are not sent it. Types not listed here
+// are part of every version.
+var sinceVersion = map[string]int{
+	"ack":         1,
+	"chatEdited":  1,
+	"chatDeleted": 1,
+	"chatCleared": 1,
+}
+
+// ackMessage confirms a client frame was handled.
+var ackMessage = map[string]string{"type": "ack"}
+
+// errorMessage is the message sent to a client when its frame was rejected.
+func errorMessage(text string) map[string]string {
+	return map[string]string{"type": "error", "error": text}
+}
+
+// protocolVersion returns the version a socket asked for with ?v=.
+func protocolVersion(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("v")
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > ProtocolVersion {
+		return 0, fmt.Errorf("unsupported protocol version %q (the newest is %d)", v, ProtocolVersion)
+	}
+	return n, nil
+}
+
+// readFrame reads the next frame a client sent. A version 0 object is
+// returned as an envelope too: its "type" field (default "chat") is the type
+// and the whole object is the payload. Errors other than errBadFrame come
+// from the connection and end it.
+func readFrame(conn *websocket.Conn, version int) (Envelope, error) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	if version == 0 {
+		var legacy struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return Envelope{}, fmt.Errorf("%w: %v", errBadFrame, err)
+		}
+		if legacy.Type == "" {
+			legacy.Type = "chat"
+		}
+		return Envelope{Type: legacy.Type, Payload: data}, nil
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", errBadFrame, err)
+	}
+	if env.Version != version {
+		return env, fmt.Errorf("%w: version %d frame on a version %d connection", errBadFrame, env.Version, version)
+	}
+	if env.Type == "" {
+		return env, fmt.Errorf("%w: missing type", errBadFrame)
+	}
+	return env, nil
+}
+
+// decodePayload unmarshals a frame's payload into v. A missing payload
+// leaves v unchanged.
+func decodePayload(env Envelope, v interface{}) error {
+	if len(env.Payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Payload, v); err != nil {
+		return fmt.Errorf("%w: %s payload: %v", errBadFrame, env.Type, err)
+	}
+	return nil
+}
+
+// messageType returns the type of one of the server's messages: a
+// ChatMessage, or a map whose "type" entry names it.
+func messageType(msg interface{}) string {
+	switch m := msg.(type) {
+	case ChatMessage:
+		return "chat"
+	case map[string]interface{}:
+		t, _ := m["type"].(string)
+		return t
+	case map[string]string:
+		return m["type"]
+	}
+	return ""
+}
+
+// frame shapes one of the server's messages for a client of the given
+// version. Version 0 clients get it as it is, later versions get it in an
+// envelope with the type taken out of the payload.
+func frame(version int, id string, msg interface{}) interface{} {
+	if version == 0 {
+		return msg
+	}
+	env := outEnvelope{Version: version, Type: messageType(msg), ID: id, Payload: msg}
+	switch m := msg.(type) {
+	case map[string]interface{}:
+		payload := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if k != "type" {
+				payload[k] = v
+			}
+		}
+		env.Payload = payload
+	case map[string]string:
+		payload := make(map[string]string, len(m))
+		for k, v := range m {
+			if k != "type" {
+				payload[k] = v
+			}
+		}
+		env.Payload = payload
+		if len(payload) == 0 {
+			env.Payload = nil
+		}
+	}
+	return env
+}
+
+// writeFrame writes a message to a connection in the client's version. id
+// is the client frame being answered, if any. Messages newer than the
+// client's version are skipped, and acks only go to clients that asked for
+// one.
+func writeFrame(conn *websocket.Conn, version int, id string, msg interface{}) error {
+	t := messageType(msg)
+	if version < sinceVersion[t] || (t == "ack" && id == "") {
+		return nil
+	}
+	return conn.WriteJSON(frame(version, id, msg))
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"othello/business_logic"
+	"othello/data_access"
+)
+
+// ratingView is the JSON form of a rating row.
+func ratingView(r data_access.PlayerRating) map[string]interface{} {
+	return map[string]interface{}{
+		"category":    r.Category,
+		"rating":      r.Rating,
+		"rd":          r.RD,
+		"volatility":  r.Volatility,
+		"gamesPlayed": r.GamesPlayed,
+		"wins":        r.Wins,
+		"losses":      r.Losses,
+		"draws":       r.Draws,
+	}
+}
+
+// GetRatingHandler returns a user's ratings, one per time-control category
+// they have played rated games in. With ?category= only that category is
+// returned, falling back to the default rating if they have not played it.
+func GetRatingHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("name")
+	ctx := r.Context()
+
+	if category := r.URL.Query().Get("category"); category != "" {
+		rating, ok, err := data_access.GetRating(ctx, username, category)
+		if err != nil {
+			jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve rating"})
+			return
+		}
+		if !ok {
+			g := business_logic.NewGlicko()
+			rating = data_access.PlayerRating{Category: category, Rating: g.Rating, RD: g.RD, Volatility: g.Volatility}
+		}
+		view := ratingView(rating)
+		view["username"] = username
+		view["provisional"] = !ok
+		jsonResponse(w, http.StatusOK, view)
+		return
+	}
+
+	ratings, err := data_access.GetRatings(ctx, username)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve ratings"})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(ratings))
+	for _, rt := range ratings {
+		out = append(out, ratingView(rt))
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"username": username, "ratings": out})
+}
+
+// GetRatingHistoryHandler returns a user's rating after each rated game in a
+// category (?category=, default blitz), oldest first, for charting.
+func GetRatingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	if category == "" {
+		category = business_logic.CategoryBlitz
+	}
+	limit := 100
+	if q := r.URL.Query().Get("limit"); q != "" {
+		if v, err := strconv.Atoi(q); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+	}
+
+	history, err := data_access.GetRatingHistory(r.Context(), r.PathValue("name"), category, limit)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve rating history"})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(history))
+	for _, h := range history {
+		out = append(out, map[string]interface{}{
+			"gameId": h.GameID,
+			"rating": h.Rating,
+			"rd":     h.RD,
+			"change": h.Change,
+			"time":   h.RecordedAt.Format(time.RFC3339),
+		})
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"username": r.PathValue("name"),
+		"category": category,
+		"history":  out,
+	})
+}
+
+// Leaderboard paging limits.
+const (
+	defaultLeaderboardPageSize = 25
+	maxLeaderboardPageSize     = 100
+)
+
+// LeaderboardAPIHandler returns one page of the leaderboard as JSON.
+// Query parameters: category (default blitz), minGames (default 0),
+// page (1-based, default 1) and pageSize (default 25, max 100).
+func LeaderboardAPIHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	category := q.Get("category")
+	if category == "" {
+		category = business_logic.CategoryBlitz
+	}
+	switch category {
+	case business_logic.CategoryBullet, business_logic.CategoryBlitz, business_logic.CategoryRapid,
+		business_logic.CategoryClassical, business_logic.CategoryUntimed:
+	default:
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "unknown category " + category})
+		return
+	}
+
+	minGames, page, pageSize := 0, 1, defaultLeaderboardPageSize
+	if v, err := strconv.Atoi(q.Get("minGames")); err == nil && v > 0 {
+		minGames = v
+	}
+	if v, err := strconv.Atoi(q.Get("page")); err == nil && v > 0 {
+		page = v
+	}
+	if v, err := strconv.Atoi(q.Get("pageSize")); err == nil && v > 0 {
+		pageSize = min(v, maxLeaderboardPageSize)
+	}
+
+	offset := (page - 1) * pageSize
+	rows, total, err := data_access.Leaderboard(r.Context(), category, minGames, pageSize, offset)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": "could not retrieve leaderboard"})
+		return
+	}
+
+	players := make([]map[string]interface{}, 0, len(rows))
+	for i, rt := range rows {
+		view := ratingView(rt)
+		view["rank"] = offset + i + 1
+		view["username"] = rt.Username
+		if rt.GamesPlayed > 0 {
+			view["winRate"] = float64(rt.Wins) / float64(rt.GamesPlayed)
+		}
+		players = append(players, view)
+	}
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"category": category,
+		"minGames": minGames,
+		"page":     page,
+		"pageSize": pageSize,
+		"total":    total,
+		"players":  players,
+	})
+}
+
+// LeaderboardHandler serves the leaderboard page, which loads its data from
+// /api/leaderboard.
+func LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "./static/leaderboard.html")
+}
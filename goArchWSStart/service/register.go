@@ -93,7 +93,11 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Validate password and hash it before storing
+		// Validate username and password, and hash the password before storing
+		if err := business_logic.ValidateUsername(username); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err := business_logic.ValidatePassword(password); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+
+	"othello/business_logic"
+)
+
+// GamePositionHandler returns a game's board after a given ply, for the
+// replay viewer: ply 0 is the starting position, the game's move count the
+// current one. Along with the board it gives the disc counts, the side to
+// move and its legal moves, and the move that led there with the discs it
+// flipped.
+func GamePositionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	ply, err := strconv.Atoi(r.PathValue("ply"))
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid ply"})
+		return
+	}
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	p, res, err := business_logic.PositionAt(g.Moves, ply)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	black, white := p.Board.Count()
+	toMove := ""
+	if !p.IsGameOver() {
+		toMove = p.ToMove.String()
+	}
+	out := map[string]interface{}{
+		"gameId":     g.ID,
+		"ply":        ply,
+		"moveCount":  len(g.Moves),
+		"board":      p.Board.String(),
+		"blackCount": black,
+		"whiteCount": white,
+		"toMove":     toMove,
+		"legalMoves": business_logic.SquareNames(p.LegalMoves()),
+	}
+	if ply > 0 {
+		out["lastMove"] = moveList(g.Moves[ply-1 : ply])[0]
+		out["flipped"] = business_logic.SquareNames(res.Flipped)
+		out["passed"] = res.Passed
+	}
+	jsonResponse(w, http.StatusOK, out)
+}
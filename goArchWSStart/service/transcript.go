@@ -0,0 +1,71 @@
+package service
+
+import (
+	"io"
+	"net/http"
+
+	"othello/business_logic"
+)
+
+// maxTranscriptBytes bounds an uploaded transcript; a full game with headers
+// is well under 1 KB.
+const maxTranscriptBytes = 16 << 10
+
+// ExportGameHandler returns a game as plain text. ?format=moves gives the
+// bare move list ("f5d6c3..."); the default, pgn, adds the header lines.
+func ExportGameHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := gameIDParam(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	g, err := business_logic.LoadGame(id)
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+
+	var text string
+	switch r.URL.Query().Get("format") {
+	case "moves":
+		text = business_logic.FormatMoveList(g.Moves) + "\n"
+	case "", "pgn":
+		if text, err = business_logic.ExportTranscript(g); err != nil {
+			jsonResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+	default:
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "format must be moves or pgn"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text)
+}
+
+// ImportGameHandler stores a game from a transcript or bare move list sent
+// as the request body. Every move is replayed and checked before anything
+// is stored; imported games are unrated and do not show in game lists.
+func ImportGameHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUsername(r); !ok {
+		jsonResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxTranscriptBytes+1))
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return
+	}
+	if len(body) > maxTranscriptBytes {
+		jsonResponse(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "transcript too large"})
+		return
+	}
+
+	g, err := business_logic.ImportTranscript(string(body))
+	if err != nil {
+		jsonResponse(w, gameErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	state := gameState(g)
+	state["moves"] = moveList(g.Moves)
+	jsonResponse(w, http.StatusCreated, state)
+}
@@ -28,6 +28,19 @@ func lookupSession(token string) (string, bool) {
 	return u, ok
 }
 
+// sessionUsername returns the username for the request's session cookie,
+// checking the in-memory session store first and then the account table.
+func sessionUsername(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("session")
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	if username, ok := lookupSession(cookie.Value); ok {
+		return username, true
+	}
+	return data_access.GetUsernameByToken(cookie.Value)
+}
+
 // LoginHandler serves the login form (GET) and processes login (POST)
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
@@ -86,7 +99,7 @@ func MeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if username, ok := lookupSession(cookie.Value); ok {
-		jsonResponse(w, http.StatusOK, map[string]string{"username": username})
+		jsonResponse(w, http.StatusOK, map[string]interface{}{"username": username, "moderator": business_logic.IsModerator(username)})
 		return
 	}
 
@@ -129,11 +142,8 @@ func LobbyHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./static/index.html")
 }
 
+// ListHandler returns everyone with a socket open and what they are doing:
+// {"users": [{"username", "status"}]}, the same list the lobby gets pushed.
 func ListHandler(w http.ResponseWriter, r *http.Request) {
-	users, err := business_logic.ListUsers()
-	if err != nil {
-		http.Error(w, "could not retrieve user list", http.StatusInternalServerError)
-		return
-	}
-	jsonResponse(w, http.StatusOK, map[string][]string{"users": users})
+	jsonResponse(w, http.StatusOK, map[string]interface{}{"users": Online.Snapshot()})
 }
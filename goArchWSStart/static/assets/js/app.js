@@ -35,90 +35,572 @@ async function guestLogin() {
     await login();
 }
 
-async function getBoard() {
-window.location.href = '/board';
-            return;}
+// ---- Challenges ----
+// pending challenges by id, kept in sync with challenge* events from the server
+const challenges = new Map();
+
+async function challengeRequest(method, url, body) {
+    const res = await fetch(url, {
+        method,
+        headers: body ? { 'Content-Type': 'application/json' } : undefined,
+        body: body ? JSON.stringify(body) : undefined,
+        credentials: 'same-origin'
+    });
+    const data = await res.json().catch(() => ({}));
+    if (!res.ok) alert(data.error || `Request failed (${res.status})`);
+    return res.ok ? data : null;
+}
+
+// selectedTimeControl returns the lobby's time-control choice, e.g. "5+3" ("" = untimed)
+function selectedTimeControl() {
+    const tcEl = document.getElementById('time-control');
+    return tcEl ? tcEl.value : '';
+}
+
+async function sendChallenge(to) {
+    const colorEl = document.getElementById('challenge-color'),
+          ratedEl = document.getElementById('challenge-rated');
+    const c = await challengeRequest('POST', '/api/challenges', {
+        to,
+        color: colorEl ? colorEl.value : 'random',
+        timeControl: selectedTimeControl(),
+        rated: ratedEl ? ratedEl.checked : false
+    });
+    if (c) { challenges.set(c.id, c); renderChallenges(); }
+}
+
+async function loadChallenges() {
+    const data = await challengeRequest('GET', '/api/challenges');
+    if (!data) return;
+    challenges.clear();
+    data.challenges.forEach(c => challenges.set(c.id, c));
+    renderChallenges();
+}
+
+function renderChallenges() {
+    const listEl = document.getElementById('challenge-list');
+    if (!listEl) return;
+    listEl.innerHTML = '';
+    challenges.forEach(c => {
+        const li = document.createElement('li');
+        const mine = c.from === USERNAME;
+        const tc = (c.timeControl || 'untimed') + (c.rated ? ', rated' : '');
+        li.textContent = mine
+            ? `You challenged ${c.to || 'anyone'} (${c.color}, ${tc}) `
+            : `${c.from} challenges ${c.to ? 'you' : 'anyone'} (they play ${c.color}, ${tc}) `;
+        const actions = mine
+            ? [['Cancel', () => challengeRequest('DELETE', `/api/challenges/${c.id}`)]]
+            : [['Accept', () => challengeRequest('POST', `/api/challenges/${c.id}/accept`)]];
+        if (!mine && c.to) actions.push(['Decline', () => challengeRequest('POST', `/api/challenges/${c.id}/decline`)]);
+        actions.forEach(([label, fn]) => {
+            const btn = document.createElement('button');
+            btn.textContent = label;
+            btn.addEventListener('click', async () => {
+                if (await fn()) { challenges.delete(c.id); renderChallenges(); }
+            });
+            li.appendChild(btn);
+        });
+        listEl.appendChild(li);
+    });
+}
+
+// ---- Play the computer ----
+// Uses the challenge form's color choice and the lobby time control.
+async function playComputer() {
+    const levelEl = document.getElementById('computer-level'),
+          colorEl = document.getElementById('challenge-color');
+    const g = await challengeRequest('POST', '/api/games/computer', {
+        level: levelEl ? levelEl.value : 'medium',
+        color: colorEl ? colorEl.value : 'random',
+        timeControl: selectedTimeControl()
+    });
+    if (g) window.location.href = `/board?game=${g.gameId}`;
+}
+
+// ---- Live games ----
+// Refreshed every few seconds so the spectator counts stay current.
+async function loadLiveGames() {
+    const listEl = document.getElementById('live-games');
+    if (!listEl) return;
+    // a plain fetch: a failed background refresh should not pop up alerts
+    const res = await fetch('/api/games/live');
+    if (!res.ok) return;
+    const data = await res.json();
+    listEl.innerHTML = '';
+    if (data.games.length === 0) {
+        listEl.textContent = 'No games in progress';
+        return;
+    }
+    data.games.forEach(g => {
+        const li = document.createElement('li');
+        const tc = (g.timeControl || 'untimed') + (g.rated ? ', rated' : '');
+        li.textContent = `${g.black} vs ${g.white} (${tc}), ${g.spectators} watching `;
+        const link = document.createElement('a');
+        link.href = `/board?game=${g.gameId}`;
+        link.textContent = [g.black, g.white].includes(USERNAME) ? 'Play' : 'Watch';
+        li.appendChild(link);
+        listEl.appendChild(li);
+    });
+}
+
+// ---- Direct messages ----
+// Conversations come from /api/dms; new messages arrive over the lobby socket.
+let dmWith = null,     // the open conversation
+    dmNext = null;     // cursor for its older messages, null when there are none
+
+function setUnread(total) {
+    const el = document.getElementById('dm-unread');
+    if (!el) return;
+    el.textContent = total;
+    el.style.display = total > 0 ? 'inline' : 'none';
+}
+
+async function loadConversations() {
+    const listEl = document.getElementById('dm-conversations');
+    if (!listEl) return;
+    const data = await challengeRequest('GET', '/api/dms');
+    if (!data) return;
+    setUnread(data.unread);
+    listEl.innerHTML = '';
+    data.conversations.forEach(c => {
+        const li = document.createElement('li');
+        li.textContent = `${c.with}: ${c.last.body.slice(0, 40)}`;
+        if (c.unread > 0) {
+            const badge = document.createElement('span');
+            badge.className = 'unread-badge';
+            badge.textContent = c.unread;
+            li.appendChild(badge);
+        }
+        li.addEventListener('click', () => openConversation(c.with));
+        listEl.appendChild(li);
+    });
+}
+
+async function openConversation(name) {
+    dmWith = name;
+    dmNext = null;
+    document.getElementById('dm-thread').style.display = 'block';
+    document.getElementById('dm-with').textContent = `Conversation with ${name}`;
+    document.getElementById('dm-messages').innerHTML = '';
+    await loadOlderMessages();
+    const box = document.getElementById('dm-messages');
+    box.scrollTop = box.scrollHeight;
+    await challengeRequest('POST', `/api/dms/${encodeURIComponent(name)}/read`);
+    await loadConversations();
+}
+
+// loadOlderMessages prepends the next page back in the open conversation
+async function loadOlderMessages() {
+    const cursor = dmNext ? `?before=${dmNext}` : '';
+    const data = await challengeRequest('GET', `/api/dms/${encodeURIComponent(dmWith)}${cursor}`);
+    if (!data) return;
+    const box = document.getElementById('dm-messages');
+    data.messages.forEach(m => box.prepend(dmRow(m)));
+    dmNext = data.next || null;
+    document.getElementById('dm-older-btn').style.display = dmNext ? 'inline-block' : 'none';
+}
+
+function dmRow(m) {
+    const row = document.createElement('div');
+    row.className = m.from === USERNAME ? 'mine' : '';
+    row.textContent = `${m.from}: ${m.body}`;
+    return row;
+}
+
+async function sendDirectMessage() {
+    const input = document.getElementById('dm-input'),
+          text = input.value.trim();
+    if (!text || !dmWith) return;
+    // the lobby socket echoes the message back, which adds it to the thread
+    if (await challengeRequest('POST', `/api/dms/${encodeURIComponent(dmWith)}`, { message: text })) input.value = '';
+}
+
+async function receiveDirectMessage(message) {
+    const m = message.message,
+          other = m.from === USERNAME ? m.to : m.from;
+    if (other === dmWith) {
+        const box = document.getElementById('dm-messages');
+        box.appendChild(dmRow(m));
+        box.scrollTop = box.scrollHeight;
+        if (m.to === USERNAME) await challengeRequest('POST', `/api/dms/${encodeURIComponent(other)}/read`);
+    }
+    await loadConversations();
+}
+
+// ---- Play now queue ----
+let inQueue = false;
+
+async function toggleQueue() {
+    const ok = inQueue
+        ? await challengeRequest('DELETE', '/api/queue')
+        : await challengeRequest('POST', '/api/queue', { timeControl: selectedTimeControl() });
+    if (ok) setQueueState(!inQueue);
+}
+
+function setQueueState(queued, text) {
+    inQueue = queued;
+    const btn = document.getElementById('play-now-btn');
+    if (btn) btn.textContent = queued ? 'Leave Queue' : 'Play Now';
+    const statusEl = document.getElementById('queue-status');
+    if (statusEl) statusEl.textContent = text || (queued ? 'Looking for an opponent...' : '');
+}
+
+// handleServerEvent processes non-chat frames pushed over the lobby socket,
+// given the frame's type and payload. It returns true if it handled the frame.
+function handleServerEvent(type, message) {
+    switch (type) {
+        case 'challenge':
+            challenges.set(message.challenge.id, message.challenge);
+            renderChallenges();
+            return true;
+        case 'challengeAccepted':
+        case 'challengeDeclined':
+        case 'challengeCancelled':
+        case 'challengeExpired':
+            challenges.delete(message.challenge.id);
+            renderChallenges();
+            return true;
+        case 'gameStart':
+        case 'matchFound':
+            window.location.href = `/board?game=${message.gameId}`;
+            return true;
+        case 'queueJoined':
+            setQueueState(true, `Looking for a ${message.timeControl || 'untimed'} game...`);
+            return true;
+        case 'queueLeft':
+            setQueueState(false);
+            return true;
+        case 'error':
+            alert(message.error);
+            return true;
+        case 'userList':
+            ONLINE_USERS.clear();
+            message.users.forEach(user => ONLINE_USERS.set(user.username, user.status));
+            displayOnlineUsers();
+            return true;
+        case 'presence':
+            if (message.status === 'offline') ONLINE_USERS.delete(message.username);
+            else ONLINE_USERS.set(message.username, message.status);
+            displayOnlineUsers();
+            return true;
+        case 'dm':
+            receiveDirectMessage(message);
+            return true;
+        case 'chatEdited': {
+            const row = chatRow(message.message.id);
+            if (row) fillMessage(row, message.message);
+            return true;
+        }
+        case 'chatDeleted': {
+            const row = chatRow(message.id);
+            if (row) row.remove();
+            return true;
+        }
+        case 'chatCleared':
+            // a moderator removed everything someone wrote
+            message.ids.forEach(id => {
+                const row = chatRow(id);
+                if (row) row.remove();
+            });
+            return true;
+        case 'dmRead':
+            setUnread(message.unread);
+            return true;
+    }
+    return false;
+}
+
+// CURRENT_GAME is the game shown in the lobby turn indicator, if any.
+let CURRENT_GAME = null;
 
 async function fetchTurn() {
-    const res = await fetch(`/turn`),
+    const turnEl = document.getElementById(`turn`);
+    if (!turnEl) return;
+    if (!CURRENT_GAME) {
+        turnEl.textContent = `No active game`;
+        return;
+    }
+    const res = await fetch(`/turn?game=${CURRENT_GAME}`),
           data = await res.json();
-    document.getElementById(`turn`).textContent = data.currentTurn;
+    turnEl.textContent = res.ok ? data.currentTurn : data.error;
 }
 
-async function nextTurn() {
-    const res = await fetch(`/next`),
+async function nextTurn(move) {
+    if (!CURRENT_GAME) return;
+    const res = await fetch(`/next?game=${CURRENT_GAME}&move=${encodeURIComponent(move)}`),
           data = await res.json();
-    document.getElementById(`turn`).textContent = data.nextTurn;
+    document.getElementById(`turn`).textContent = res.ok ? data.nextTurn : data.error;
 }
 
 let USERNAME = null; // will be fetched from server session
+let IS_MODERATOR = false;
 let ws;
 
 function connectWebSocket() {
-            const protocol = window.location.protocol === `https:` ? `wss:` : `ws:`,
-                // rely on server-side session (cookie) to authenticate the websocket
-                wsUrl = `${protocol}//${window.location.host}/ws/chat`;
-    
-    ws = new WebSocket(wsUrl);
+    // rely on server-side session (cookie) to authenticate the websocket
+    ws = openSocket(`/ws/chat`);
 
     ws.onopen = () => {
         console.log(`WebSocket connected`);
+        loadChatHistory();
     };
     ws.onerror = (error) => {
         console.log(`WebSocket error`, error);
     };
     ws.onclose = () => {
         console.log(`WebSocket disconnected`);
+        failPendingFrames();
         //attempt to reconnect after 3 seconds
         setTimeout(connectWebSocket, 3000);
     };
     ws.onmessage = (event) => {
         console.log(`WebSocket`, event);
-        const message = JSON.parse(event.data);
-        displayMessage(message);
-        if (message.type === 'userList') {
-            displayOnlineUsers(message.users);
-        }
+        const frame = readFrame(event);
+        if (!frame || handleServerEvent(frame.type, frame.payload)) return;
+        if (frame.type === `chat`) displayMessage(frame.payload);
     };
     
 }
-function displayOnlineUsers(users) {
+// ONLINE_USERS maps each online username to their status, kept up to date
+// from the server's userList and presence events.
+const ONLINE_USERS = new Map();
+
+const STATUS_LABELS = {
+    idle: 'idle',
+    inGame: 'in game',
+    lookingForGame: 'looking for game',
+};
+
+function displayOnlineUsers() {
     const userListEl = document.getElementById('user-list');
     if (!userListEl) return;
     userListEl.innerHTML = '';
-    users.forEach(user => {
-        const li = document.createElement('li');
-        li.textContent = user.username;
+    [...ONLINE_USERS.keys()].sort().forEach(username => {
+        const status = ONLINE_USERS.get(username),
+              li = document.createElement('li'),
+              label = document.createElement('span');
+        li.textContent = username;
+        li.className = `user-status-${status}`;
+        label.className = 'user-status';
+        label.textContent = ` (${STATUS_LABELS[status] || status})`;
+        li.appendChild(label);
         userListEl.appendChild(li);
     });
 }
-function displayMessage(message) {
+// ---- Lobby chat ----
+// The socket only carries new messages; history comes from /api/chat/history
+// a page at a time. chatNewest is the newest message shown, used to catch up
+// after a reconnect, and chatOlder the cursor of the page before the oldest
+// one (null once the start of the room is shown).
+let chatNewest = null, chatOlder = null, chatLoading = false;
+
+async function fetchChatPage(query) {
+    const res = await fetch(`/api/chat/history?room=lobby&${query}`, { credentials: 'same-origin' });
+    if (!res.ok) {
+        console.log(`Chat history request failed`, res.status);
+        return null;
+    }
+    return res.json();
+}
+
+// loadChatHistory runs when the socket opens: the first time it shows the
+// latest page, after a reconnect the messages missed in between.
+async function loadChatHistory() {
+    const chatContent = document.getElementById(`chat-content`);
+    if (chatNewest === null) {
+        const data = await fetchChatPage(``);
+        if (!data) return;
+        data.messages.forEach(placeMessage);
+        chatOlder = data.older || null;
+        chatContent.scrollTop = chatContent.scrollHeight;
+        return;
+    }
+    for (let after = chatNewest; after;) {
+        const data = await fetchChatPage(`after=${after}`);
+        if (!data) return;
+        data.messages.forEach(placeMessage);
+        after = data.newer;
+    }
+    chatContent.scrollTop = chatContent.scrollHeight;
+}
+
+// loadOlderChat adds the page before the oldest message shown, keeping the
+// visible messages where they are. It is called when the chat is scrolled to
+// the top.
+async function loadOlderChat() {
+    if (!chatOlder || chatLoading) return;
+    chatLoading = true;
     const chatContent = document.getElementById(`chat-content`),
-                    timeText = new Date(message.time).toLocaleTimeString(`en-US`, { hour12: false });
-        const sender = message.username || message.user || 'Anon';
-        const html = `
-                    <div class="chat-message">
-                        <span class="message-time">[${timeText}]</span>
-                        <strong class="message-sender">${sender}:</strong>
-                        <span class="message-text"> ${message.message}</span>
-                    </div>
-                `;
-    chatContent.insertAdjacentHTML(`beforeend`, html);
+          height = chatContent.scrollHeight,
+          data = await fetchChatPage(`before=${chatOlder}`);
+    chatLoading = false;
+    if (!data) return;
+    data.messages.forEach(placeMessage);
+    chatOlder = data.older || null;
+    chatContent.scrollTop += chatContent.scrollHeight - height;
+}
+
+// displayMessage shows a new message and scrolls to it.
+function displayMessage(message) {
+    const chatContent = document.getElementById(`chat-content`);
+    placeMessage(message);
     chatContent.scrollTop = chatContent.scrollHeight;
+}
+
+// placeMessage adds a message to the chat in ID order. A message that is
+// already shown (e.g. broadcast while its page was loading) is skipped.
+function placeMessage(message) {
+    if (message.id && chatRow(message.id)) return;
+    const chatContent = document.getElementById(`chat-content`),
+          row = document.createElement(`div`),
+          time = document.createElement(`span`),
+          sender = document.createElement(`strong`),
+          text = document.createElement(`span`);
+    row.className = `chat-message`;
+    if (message.id) row.dataset.id = message.id;
+    time.className = `message-time`;
+    time.textContent = `[${new Date(message.time).toLocaleTimeString(`en-US`, { hour12: false })}]`;
+    sender.className = `message-sender`;
+    sender.textContent = ` ${message.username || message.user || 'Anon'}:`;
+    text.className = `message-text`;
+    row.append(time, sender, text);
+    fillMessage(row, message);
+
+    // authors can change their own messages; other people's can be
+    // reported, and removed by moderators
+    if (message.id && USERNAME && message.username === USERNAME) {
+        row.append(
+            messageAction(`edit`, () => editMessage(row)),
+            messageAction(`delete`, () => deleteMessage(row)));
+    } else if (message.id && USERNAME) {
+        row.append(messageAction(`report`, () => reportMessage(row)));
+        if (IS_MODERATOR) row.append(messageAction(`remove`, () => removeMessage(row.dataset.id)));
+    }
+
+    let next = null;
+    if (message.id) {
+        next = [...chatContent.querySelectorAll(`.chat-message[data-id]`)]
+            .find(other => Number(other.dataset.id) > message.id) || null;
+        if (chatNewest === null || message.id > chatNewest) chatNewest = message.id;
+    }
+    chatContent.insertBefore(row, next);
+}
+
+function messageAction(label, onClick) {
+    const btn = document.createElement(`button`);
+    btn.className = `message-action`;
+    btn.textContent = label;
+    btn.addEventListener(`click`, onClick);
+    return btn;
+}
+
+// fillMessage shows a message's (possibly edited) text in its row.
+function fillMessage(row, message) {
+    const text = row.querySelector(`.message-text`);
+    renderChatText(text, message.tokens, message.message);
+    text.prepend(` `);
+    if (message.edited) {
+        const marker = document.createElement(`em`);
+        marker.className = `message-edited`;
+        marker.textContent = ` (edited)`;
+        marker.title = `edited ${new Date(message.editedAt).toLocaleString()}`;
+        text.appendChild(marker);
+    }
+    row.dataset.text = message.message;
+}
+
+function chatRow(id) {
+    return document.querySelector(`#chat-content .chat-message[data-id="${id}"]`);
+}
+
+function editMessage(row) {
+    const text = prompt(`Edit message`, row.dataset.text);
+    if (text === null || text.trim() === row.dataset.text) return;
+    sendFrame(ws, `chatEdit`, { id: Number(row.dataset.id), message: text })
+        .catch(err => alert(`Could not edit message: ${err.message}`));
+}
+
+function deleteMessage(row) {
+    if (!confirm(`Delete this message?`)) return;
+    sendFrame(ws, `chatDelete`, { id: Number(row.dataset.id) })
+        .catch(err => alert(`Could not delete message: ${err.message}`));
+}
+
+async function reportMessage(row) {
+    const reason = prompt(`Why are you reporting this message?`);
+    if (reason === null) return;
+    if (await challengeRequest(`POST`, `/api/chat/messages/${row.dataset.id}/report`, { reason })) {
+        alert(`Thanks, the moderators will take a look.`);
+    }
+}
+
+// ---- Moderation (moderators only) ----
+async function removeMessage(id) {
+    const reason = prompt(`Remove this message? Reason (optional):`);
+    if (reason === null) return;
+    if (await challengeRequest(`DELETE`, `/api/moderation/messages/${id}`, { reason })) {
+        await loadReports();
+    }
+}
+
+async function moderate(action) {
+    const username = document.getElementById(`mod-user`).value.trim(),
+          reason = document.getElementById(`mod-reason`).value.trim(),
+          duration = document.getElementById(`mod-duration`).value.trim();
+    if (!username) return;
+    const base = `/api/moderation/users/${encodeURIComponent(username)}`,
+          requests = {
+              mute: [`POST`, `${base}/mute`, { duration, reason }],
+              unmute: [`DELETE`, `${base}/mute`],
+              ban: [`POST`, `${base}/ban`, { reason }],
+              unban: [`DELETE`, `${base}/ban`],
+              clear: [`POST`, `${base}/clear`, { reason }],
+          };
+    if (action === `clear` && !confirm(`Delete every chat message ${username} wrote?`)) return;
+    if (await challengeRequest(...requests[action])) alert(`Done: ${action} ${username}`);
+}
 
+async function loadReports() {
+    if (!IS_MODERATOR) return;
+    const data = await challengeRequest(`GET`, `/api/moderation/reports`);
+    if (!data) return;
+    const listEl = document.getElementById(`mod-reports`);
+    listEl.innerHTML = ``;
+    data.reports.forEach(report => {
+        const li = document.createElement(`li`);
+        li.textContent = `${report.reportedUser} in ${report.room}: "${report.message}" (reported by ${report.reporter}${report.reason ? `: ${report.reason}` : ``}) `;
+        li.append(
+            messageAction(`remove message`, () => removeMessage(report.messageId)),
+            messageAction(`resolve`, async () => {
+                if (await challengeRequest(`POST`, `/api/moderation/reports/${report.id}/resolve`)) await loadReports();
+            }));
+        listEl.appendChild(li);
+    });
 }
 
 function sendMessage() {
     const messageInput = document.getElementById(`chat-message`),
           messageText = messageInput.value.trim();
 
-    if(!messageText || !ws || ws.readyState !== WebSocket.OPEN) return;
+    if(!messageText || document.getElementById(`send-btn`).disabled) return;
     const message = {
         message: messageText,
         time: new Date().toISOString()
     };
-    ws.send(JSON.stringify(message));
-    messageInput.value = ``;
+    // keep the text until the server has taken it
+    sendFrame(ws, `chat`, message)
+        .then(() => { if (messageInput.value.trim() === messageText) messageInput.value = ``; })
+        .catch(err => {
+            if (err.payload && err.payload.throttled) holdChat(err.payload.retryAfter);
+            alert(`Message not sent: ${err.message}`);
+        });
+}
+
+// holdChat disables the send button while the server is throttling us.
+function holdChat(seconds) {
+    const sendBtn = document.getElementById(`send-btn`);
+    sendBtn.disabled = true;
+    setTimeout(() => { sendBtn.disabled = false; }, seconds * 1000);
 }
 
 document.addEventListener(`DOMContentLoaded`, () => {
@@ -129,13 +611,46 @@ document.addEventListener(`DOMContentLoaded`, () => {
 
     if (loginBtn) loginBtn.addEventListener('click', (e) => { e.preventDefault(); login(); });
     if (guestBtn) guestBtn.addEventListener('click', (e) => { e.preventDefault(); guestLogin(); });
-    if (requestBtn) requestBtn.addEventListener('click', (e) => { e.preventDefault(); getBoard(); });
+    if (requestBtn) requestBtn.addEventListener('click', (e) => { e.preventDefault(); sendChallenge(''); });
+
+    const playNowBtn = document.getElementById('play-now-btn');
+    if (playNowBtn) playNowBtn.addEventListener('click', (e) => { e.preventDefault(); toggleQueue(); });
+    const computerBtn = document.getElementById('vs-computer-btn');
+    if (computerBtn) computerBtn.addEventListener('click', (e) => { e.preventDefault(); playComputer(); });
+
+    const dmOpenBtn = document.getElementById('dm-open-btn');
+    if (dmOpenBtn) dmOpenBtn.addEventListener('click', (e) => {
+        e.preventDefault();
+        const to = document.getElementById('dm-to').value.trim();
+        if (to) openConversation(to);
+    });
+    const dmSendBtn = document.getElementById('dm-send-btn');
+    if (dmSendBtn) dmSendBtn.addEventListener('click', (e) => { e.preventDefault(); sendDirectMessage(); });
+    const dmInput = document.getElementById('dm-input');
+    if (dmInput) dmInput.addEventListener('keypress', (e) => {
+        if (e.key === 'Enter') { e.preventDefault(); sendDirectMessage(); }
+    });
+    const dmOlderBtn = document.getElementById('dm-older-btn');
+    if (dmOlderBtn) dmOlderBtn.addEventListener('click', (e) => { e.preventDefault(); loadOlderMessages(); });
+
+    const challengeBtn = document.getElementById('challenge-btn');
+    if (challengeBtn) challengeBtn.addEventListener('click', (e) => {
+        e.preventDefault();
+        const to = document.getElementById('challenge-user').value.trim();
+        if (to) sendChallenge(to);
+    });
 
     // Chat functionality
     const sendBtn = document.getElementById(`send-btn`),
           messageInput = document.getElementById(`chat-message`);
     
     sendBtn.addEventListener(`click`, sendMessage);
+
+    // older messages load as the chat is scrolled back to the top
+    const chatContent = document.getElementById(`chat-content`);
+    chatContent.addEventListener(`scroll`, () => {
+        if (chatContent.scrollTop < 40) loadOlderChat();
+    });
     
     messageInput.addEventListener(`keypress`, (e) => {
         if (e.key === `Enter` && !e.shiftKey) {
@@ -155,12 +670,24 @@ document.addEventListener(`DOMContentLoaded`, () => {
             }
             const info = await res.json();
             USERNAME = info.username || info.name || null;
+            IS_MODERATOR = !!info.moderator;
+            if (IS_MODERATOR) {
+                document.getElementById(`moderation`).style.display = `block`;
+                document.querySelectorAll(`[data-mod-action]`).forEach(btn =>
+                    btn.addEventListener(`click`, () => moderate(btn.dataset.modAction)));
+                await loadReports();
+                setInterval(loadReports, 30000);
+            }
             const who = document.getElementById('who');
             if (who && USERNAME) who.textContent = `(${USERNAME})`;
 
             // Connect WebSocket after session verification so cookies are sent
             connectWebSocket();
             await fetchTurn();
+            await loadChallenges();
+            await loadLiveGames();
+            await loadConversations();
+            setInterval(loadLiveGames, 10000);
         } catch (e) {
             console.error('Session check failed', e);
             window.location.href = '/login.html';
@@ -0,0 +1,34 @@
+// Chat markup. The server parses each message's **bold**, `code` and links
+// into tokens (see business_logic/chat_text.go); this draws them. Token text
+// only ever becomes a text node, and links are http(s) URLs checked by the
+// server, so a message cannot inject HTML into the page.
+
+// renderChatText fills el with a chat message's tokens. Without tokens
+// (e.g. from an older server) the raw text is shown as it is.
+function renderChatText(el, tokens, text) {
+    el.textContent = ``;
+    (tokens || [{ type: `text`, text }]).forEach(token => {
+        let node;
+        switch (token.type) {
+            case `bold`:
+                node = document.createElement(`strong`);
+                break;
+            case `code`:
+                node = document.createElement(`code`);
+                break;
+            case `link`:
+                if (!/^https?:\/\//i.test(token.href || ``)) break;
+                node = document.createElement(`a`);
+                node.href = token.href;
+                node.target = `_blank`;
+                node.rel = `noopener noreferrer nofollow`;
+                break;
+        }
+        if (!node) {
+            el.appendChild(document.createTextNode(token.text));
+            return;
+        }
+        node.textContent = token.text;
+        el.appendChild(node);
+    });
+}
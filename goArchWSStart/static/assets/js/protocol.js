@@ -0,0 +1,51 @@
+// Client side of the WebSocket protocol (see service/protocol.go). Every
+// frame is an envelope: {v, type, id, payload}. Frames sent with sendFrame
+// get an id, and the promise it returns settles when the server acks the
+// frame (or answers it with an error). An error rejects it with an Error
+// whose payload holds the whole error frame, e.g. a throttle's retryAfter.
+const PROTOCOL_VERSION = 1;
+
+let nextFrameId = 1;
+const pendingFrames = new Map(); // frame id -> {resolve, reject}
+
+// openSocket connects to a WebSocket path on this host, asking for our
+// protocol version.
+function openSocket(path) {
+    const protocol = window.location.protocol === `https:` ? `wss:` : `ws:`,
+          sep = path.includes(`?`) ? `&` : `?`;
+    return new WebSocket(`${protocol}//${window.location.host}${path}${sep}v=${PROTOCOL_VERSION}`);
+}
+
+function sendFrame(ws, type, payload) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) {
+        return Promise.reject(new Error(`not connected`));
+    }
+    const id = `c${nextFrameId++}`;
+    return new Promise((resolve, reject) => {
+        pendingFrames.set(id, { resolve, reject });
+        ws.send(JSON.stringify({ v: PROTOCOL_VERSION, type, id, payload }));
+    });
+}
+
+// readFrame parses an incoming frame. Acks and errors that answer one of our
+// frames settle its promise and return null; everything else is returned for
+// the page to handle.
+function readFrame(event) {
+    const env = JSON.parse(event.data),
+          pending = env.id && pendingFrames.get(env.id);
+    if (pending) {
+        pendingFrames.delete(env.id);
+        if (env.type === `error`) pending.reject(Object.assign(new Error(env.payload.error), { payload: env.payload }));
+        else pending.resolve(env.payload);
+        return null;
+    }
+    if (env.type === `ack`) return null;
+    env.payload = env.payload || {};
+    return env;
+}
+
+// failPendingFrames rejects every unanswered frame, e.g. when the socket closed.
+function failPendingFrames() {
+    pendingFrames.forEach(pending => pending.reject(new Error(`connection closed`)));
+    pendingFrames.clear();
+}